@@ -16,6 +16,8 @@ package apollo
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"runtime/debug"
 	"sync"
 	"text/template"
@@ -29,8 +31,12 @@ type Client interface {
 	SetParser(ConfigParser)
 	ClientConfigParam(cpc *ConfigParamConfig) (ConfigParam, error)
 	ServerConfigParam(cpc *ConfigParamConfig) (ConfigParam, error)
-	RegisterConfigCallback(ConfigParam, func(string, ConfigParser), int64)
+	RegisterConfigCallback(ConfigParam, func(string, ConfigParser) error, int64) error
 	DeregisterConfig(ConfigParam, int64) error
+	Close(ctx context.Context) error
+	ConfigStates() []ConfigState
+	MetricsHook() MetricsHook
+	Status() Status
 }
 
 type ConfigParam struct {
@@ -38,6 +44,7 @@ type ConfigParam struct {
 	nameSpace string
 	Cluster   string
 	Type      ConfigType
+	category  string
 }
 
 type callbackHandler func(namespace, cluster, key, data string)
@@ -63,22 +70,44 @@ type client struct {
 	// support customise parser
 	parser            ConfigParser
 	stop              chan bool
+	closed            bool
+	listeners         sync.WaitGroup
 	clusterTemplate   *template.Template
 	serverKeyTemplate *template.Template
 	clientKeyTemplate *template.Template
 	handlerMutex      sync.RWMutex
 	handlers          map[configParamKey]map[int64]callbackHandler
+	states            *stateStore
+	metrics           MetricsHook
+	status            *syncStatus
 }
 
 const (
 	RetryConfigName          = "retry"
 	RpcTimeoutConfigName     = "rpc_timeout"
 	CircuitBreakerConfigName = "circuit_break"
-
-	LimiterConfigName = "limit"
+	FallbackConfigName       = "fallback"
+	DegradationConfigName    = "degradation"
+	ClientLimitConfigName    = "client_limit"
+	LoadBalanceConfigName    = "loadbalance"
+	RoutingConfigName        = "routing"
+	MetadataConfigName       = "metadata"
+	PayloadLimitConfigName   = "payload_limit"
+
+	LimiterConfigName     = "limit"
+	QuotaConfigName       = "quota"
+	OverloadConfigName    = "overload"
+	ACLConfigName         = "acl"
+	MaintenanceConfigName = "maintenance"
+
+	LoggingConfigName = "logging"
+	TracingConfigName = "tracing"
+
+	DiscoveryConfigName = "discovery"
 )
 
-var Close sync.Once
+// ErrClientClosed is returned when registering config callbacks to a closed client.
+var ErrClientClosed = errors.New("apollo client is closed")
 
 type Options struct {
 	ConfigServerURL string
@@ -88,6 +117,7 @@ type Options struct {
 	ClientKeyFormat string
 	ApolloOptions   []agollo.Option
 	ConfigParser    ConfigParser
+	MetricsHook     MetricsHook
 }
 
 type OptionFunc func(option *Options)
@@ -111,6 +141,9 @@ func NewClient(opts Options, optsfunc ...OptionFunc) (Client, error) {
 	if opts.ClientKeyFormat == "" {
 		opts.ClientKeyFormat = ApolloDefaultClientKey
 	}
+	if opts.MetricsHook == nil {
+		opts.MetricsHook = noopMetricsHook{}
+	}
 	opts.ApolloOptions = append(opts.ApolloOptions,
 		agollo.Cluster(opts.Cluster),
 		agollo.AutoFetchOnCacheMiss(),
@@ -119,6 +152,9 @@ func NewClient(opts Options, optsfunc ...OptionFunc) (Client, error) {
 	for _, option := range optsfunc {
 		option(&opts)
 	}
+	status := newSyncStatus(opts.MetricsHook)
+	// wrap the apollo HTTP api at last to observe the customised one as well
+	opts.ApolloOptions = append(opts.ApolloOptions, withSyncStatus(status))
 	apolloCli, err := agollo.New(opts.ConfigServerURL, opts.AppID, opts.ApolloOptions...)
 	if err != nil {
 		return nil, err
@@ -143,6 +179,9 @@ func NewClient(opts Options, optsfunc ...OptionFunc) (Client, error) {
 		serverKeyTemplate: serverKeyTemplate,
 		clientKeyTemplate: clientKeyTemplate,
 		handlers:          make(map[configParamKey]map[int64]callbackHandler),
+		states:            newStateStore(),
+		metrics:           opts.MetricsHook,
+		status:            status,
 	}
 
 	return cli, nil
@@ -158,6 +197,18 @@ func (c *client) SetParser(parser ConfigParser) {
 	c.parser = parser
 }
 
+// WithMetricsHook sets the hook to report the config sync health.
+func WithMetricsHook(hook MetricsHook) OptionFunc {
+	return func(option *Options) {
+		option.MetricsHook = hook
+	}
+}
+
+// MetricsHook returns the hook to report the config sync health.
+func (c *client) MetricsHook() MetricsHook {
+	return c.metrics
+}
+
 func (c *client) render(cpc *ConfigParamConfig, t *template.Template) (string, error) {
 	var tpl bytes.Buffer
 	err := t.Execute(&tpl, cpc)
@@ -188,6 +239,7 @@ func (c *client) configParam(cpc *ConfigParamConfig, t *template.Template) (Conf
 	param := ConfigParam{
 		Type:      JSON,
 		nameSpace: cpc.Category,
+		category:  cpc.Category,
 	}
 	var err error
 	param.Key, err = c.render(cpc, t)
@@ -201,7 +253,8 @@ func (c *client) configParam(cpc *ConfigParamConfig, t *template.Template) (Conf
 	return param, nil
 }
 
-// DeregisterConfig deregister the config.
+// DeregisterConfig deregister the config. The client keeps running after the last config is deregistered,
+// so the config could be registered again, call Close to stop it.
 func (c *client) DeregisterConfig(cfg ConfigParam, uniqueID int64) error {
 	configKey := getConfigParamKey(&cfg)
 	klog.Debugf("deregister key %v for uniqueID %d", configKey, uniqueID)
@@ -211,18 +264,51 @@ func (c *client) DeregisterConfig(cfg ConfigParam, uniqueID int64) error {
 	if ok {
 		delete(handlers, uniqueID)
 	}
-	// Stop when users is null
-	if len(handlers) == 0 {
-		Close.Do(func() {
-			// close listen goroutine
-			close(c.stop)
-		})
-		// close longpoll
-		c.acli.Stop()
-	}
+	c.states.deregister(configKey, uniqueID)
+	c.metrics.ActiveSubscriptions(c.states.subscriptions())
 	return nil
 }
 
+// Close deregisters all the config callbacks, stops the long poller and waits for the
+// listen goroutines to exit until ctx is done. RegisterConfigCallback returns ErrClientClosed after that.
+func (c *client) Close(ctx context.Context) error {
+	c.handlerMutex.Lock()
+	for configKey, handlers := range c.handlers {
+		for uniqueID := range handlers {
+			c.states.deregister(configKey, uniqueID)
+		}
+		delete(c.handlers, configKey)
+	}
+	c.metrics.ActiveSubscriptions(c.states.subscriptions())
+	c.shutdown()
+	c.handlerMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.listeners.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown closes the listen goroutines and the long poller, must be called with handlerMutex held.
+func (c *client) shutdown() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	// close listen goroutine
+	close(c.stop)
+	// close longpoll
+	c.acli.Stop()
+	c.status.setRunning(false)
+}
+
 // Read and execute callback functions for unique value binding
 func (c *client) onChange(namespace, cluster, key, data string) {
 	handlers := make([]callbackHandler, 0, 5)
@@ -237,76 +323,147 @@ func (c *client) onChange(namespace, cluster, key, data string) {
 		handlers = append(handlers, handler)
 	}
 	c.handlerMutex.RUnlock()
+	c.states.updateRaw(configKey, data)
+	c.metrics.ConfigReceived(namespace)
 	for _, handler := range handlers {
 		handler(namespace, cluster, key, data)
 	}
 }
 
-// RegisterConfigCallback register the callback function to apollo client.
+// RegisterConfigCallback register the callback function to apollo client. The callback returns nil
+// when it applies the config, or the error when it rejects the whole config, which is reported to the
+// MetricsHook.
 func (c *client) RegisterConfigCallback(param ConfigParam,
-	callback func(string, ConfigParser), uniqueID int64,
-) {
+	callback func(string, ConfigParser) error, uniqueID int64,
+) error {
+	configKey := getConfigParamKey(&param)
 	onChange := func(namespace, cluster, key, data string) {
 		klog.Debugf("[apollo] uniqueID %d config %s updated, namespace %s cluster %s key %s data %s",
 			uniqueID, namespace, namespace, cluster, key, data)
-		callback(data, c.parser)
+		c.applyConfig(param, data, callback)
 	}
 
+	klog.Debugf("register key %v for uniqueID %d", configKey, uniqueID)
+	c.handlerMutex.Lock()
+	if c.closed {
+		c.handlerMutex.Unlock()
+		return ErrClientClosed
+	}
+	var errorsCh <-chan *agollo.LongPollerError
+	handlers, listening := c.handlers[configKey]
+	if !listening {
+		handlers = make(map[int64]callbackHandler)
+		c.handlers[configKey] = handlers
+		c.listeners.Add(1)
+		errorsCh = c.acli.Start()
+		c.status.setRunning(true)
+	}
+	handlers[uniqueID] = onChange
+	c.states.register(param, uniqueID)
+	c.handlerMutex.Unlock()
+	c.metrics.ActiveSubscriptions(c.states.subscriptions())
+
 	configMap := c.acli.GetNameSpace(param.nameSpace)
 	data, ok := configMap[param.Key]
 	if !ok {
 		klog.Warnf("[apollo] key not found | key :%s", param.Key)
 		klog.Warnf("[apollo] configMap: %v", configMap)
 	} else {
-		callback(data.(string), c.parser)
+		c.states.updateRaw(configKey, data.(string))
+		c.metrics.ConfigReceived(param.category)
+		c.applyConfig(param, data.(string), callback)
+	}
+
+	if !listening {
+		go c.listenConfig(param, c.stop, errorsCh)
 	}
+	return nil
+}
 
-	go c.listenConfig(param, c.stop, onChange, uniqueID)
+// ConfigStates returns the state of all the registered config params.
+func (c *client) ConfigStates() []ConfigState {
+	return c.states.snapshot()
 }
 
-func (c *client) listenConfig(param ConfigParam, stop chan bool, callback func(namespace, cluster, key, data string), uniqueID int64) {
+// Status returns the health status of the client, which could be used for readiness probes.
+func (c *client) Status() Status {
+	st := c.status.snapshot()
+	st.Keys = make([]KeyStatus, 0)
+	for _, cs := range c.states.snapshot() {
+		st.Keys = append(st.Keys, KeyStatus{
+			Key:       cs.Key,
+			Namespace: cs.Namespace,
+			Cluster:   cs.Cluster,
+			Loaded:    !cs.UpdateTime.IsZero() || c.status.synced(cs.Namespace),
+		})
+	}
+	return st
+}
+
+// applyConfig executes the callback and reports the outcome, the config decoded by the callback is
+// recorded as the effective one only if it's applied.
+func (c *client) applyConfig(param ConfigParam, data string, callback func(string, ConfigParser) error) {
+	var (
+		failed  bool
+		decoded interface{}
+	)
+	err := callback(data, &recordParser{
+		ConfigParser: c.parser,
+		record: func(config interface{}, err error) {
+			if err != nil {
+				failed = true
+				return
+			}
+			// the document is decoded first, the later decodes are parts of it
+			if decoded == nil {
+				decoded = config
+			}
+		},
+	})
+	switch {
+	case failed:
+		c.metrics.DecodeFailed(param.category)
+	case err != nil:
+		c.metrics.ValidationRejected(param.category)
+	default:
+		c.metrics.ConfigApplied(param.category)
+		if decoded != nil {
+			c.states.updateEffective(getConfigParamKey(&param), decoded)
+		}
+	}
+}
+
+// listenConfig listens the changes of the key until stop is closed, one goroutine for every key.
+func (c *client) listenConfig(param ConfigParam, stop chan bool, errorsCh <-chan *agollo.LongPollerError) {
+	defer c.listeners.Done()
 	defer func() {
 		if err := recover(); err != nil {
-			klog.Error("[apollo] listen goroutine error: %v, stack: %s", err, string(debug.Stack()))
+			klog.Errorf("[apollo] listen goroutine error: %v, stack: %s", err, string(debug.Stack()))
 		}
 	}()
 
-	configKey := getConfigParamKey(&param)
-	klog.Debugf("register key %v for uniqueID %d", configKey, uniqueID)
-	c.handlerMutex.Lock()
-	handlers, ok := c.handlers[configKey]
-	if !ok {
-		handlers = make(map[int64]callbackHandler)
-		c.handlers[configKey] = handlers
-	}
-	handlers[uniqueID] = callback
-	c.handlerMutex.Unlock()
+	apolloRespCh := c.acli.WatchNamespace(param.nameSpace, stop)
 
-	if !ok {
-		errorsCh := c.acli.Start()
-		apolloRespCh := c.acli.WatchNamespace(param.nameSpace, stop)
-
-		for {
-			select {
-			case resp := <-apolloRespCh:
-				data, ok := resp.NewValue[param.Key]
-				if !ok {
-					// Deal with delete config
-					klog.Warnf("[apollo] config %s error, namespace %s cluster %s key %s : error : key not found | please recover key from remote config",
-						param.nameSpace, param.nameSpace, param.Cluster, param.Key)
-					c.onChange(param.nameSpace, param.Cluster, param.Key, emptyConfig)
-					continue
-				}
-				c.onChange(param.nameSpace, param.Cluster, param.Key, data.(string))
-			case err := <-errorsCh:
-				klog.Errorf("[apollo] config %s error, namespace %s cluster %s key %s : error %s",
-					param.nameSpace, param.nameSpace, param.Cluster, param.Key, err.Err.Error())
-				return
-			case <-stop:
-				klog.Warnf("[apollo] config %s exit,namespace %s cluster %s key %s : exit",
+	for {
+		select {
+		case resp := <-apolloRespCh:
+			data, ok := resp.NewValue[param.Key]
+			if !ok {
+				// Deal with delete config
+				klog.Warnf("[apollo] config %s error, namespace %s cluster %s key %s : error : key not found | please recover key from remote config",
 					param.nameSpace, param.nameSpace, param.Cluster, param.Key)
-				return
+				c.onChange(param.nameSpace, param.Cluster, param.Key, emptyConfig)
+				continue
 			}
+			c.onChange(param.nameSpace, param.Cluster, param.Key, data.(string))
+		case err := <-errorsCh:
+			// the long poller keeps polling after errors, so keep listening as well
+			klog.Errorf("[apollo] config %s error, namespace %s cluster %s key %s : error %s",
+				param.nameSpace, param.nameSpace, param.Cluster, param.Key, err.Err.Error())
+		case <-stop:
+			klog.Warnf("[apollo] config %s exit,namespace %s cluster %s key %s : exit",
+				param.nameSpace, param.nameSpace, param.Cluster, param.Key)
+			return
 		}
 	}
 }
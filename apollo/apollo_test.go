@@ -15,12 +15,16 @@
 package apollo
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/cloudwego/kitex/pkg/klog"
 	"github.com/shima-park/agollo"
+	"go.uber.org/goleak"
 	"gopkg.in/go-playground/assert.v1"
 )
 
@@ -83,6 +87,9 @@ func TestRegisterAndDeregister(t *testing.T) {
 		acli:     fake,
 		stop:     make(chan bool),
 		handlers: make(map[configParamKey]map[int64]callbackHandler),
+		states:   newStateStore(),
+		metrics:  noopMetricsHook{},
+		status:   newSyncStatus(noopMetricsHook{}),
 	}
 
 	var gotlock sync.Mutex
@@ -107,7 +114,7 @@ func TestRegisterAndDeregister(t *testing.T) {
 			Key:       "k1",
 			nameSpace: "n1",
 			Cluster:   "c1",
-		}, func(s string, cp ConfigParser) {
+		}, func(s string, cp ConfigParser) error {
 			gotlock.Lock()
 			defer gotlock.Unlock()
 			ids, ok := gots[configkey]
@@ -117,6 +124,7 @@ func TestRegisterAndDeregister(t *testing.T) {
 				gots[configkey] = ids
 			}
 			ids[id1] = s
+			return nil
 		}, id1)
 	}()
 
@@ -133,7 +141,7 @@ func TestRegisterAndDeregister(t *testing.T) {
 			Key:       "k1",
 			nameSpace: "n1",
 			Cluster:   "c1",
-		}, func(s string, cp ConfigParser) {
+		}, func(s string, cp ConfigParser) error {
 			gotlock.Lock()
 			defer gotlock.Unlock()
 			klog.Info("onchange callback2:", s)
@@ -143,6 +151,7 @@ func TestRegisterAndDeregister(t *testing.T) {
 				gots[configkey] = ids
 			}
 			ids[id2] = s
+			return nil
 		}, id2)
 	}()
 	wg.Wait()
@@ -234,3 +243,254 @@ func TestRegisterAndDeregister(t *testing.T) {
 	}, gots)
 	gotlock.Unlock()
 }
+
+func TestConfigStates(t *testing.T) {
+	fake := NewFakeApollo()
+
+	cli := &client{
+		acli:     fake,
+		parser:   defaultConfigParse(),
+		stop:     make(chan bool),
+		handlers: make(map[configParamKey]map[int64]callbackHandler),
+		states:   newStateStore(),
+		metrics:  noopMetricsHook{},
+		status:   newSyncStatus(noopMetricsHook{}),
+	}
+	param := ConfigParam{
+		Key:       "k1",
+		nameSpace: "limit",
+		Cluster:   "c1",
+		Type:      JSON,
+		category:  "limit",
+	}
+
+	fake.Lock()
+	fake.len++
+	fake.Unlock()
+
+	id := GetUniqueID()
+	cli.RegisterConfigCallback(param, func(s string, cp ConfigParser) error {
+		cfg := map[string]int{}
+		return cp.Decode(param.Type, s, &cfg)
+	}, id)
+	// wait the goroutine init
+	time.Sleep(1 * time.Second)
+
+	status := cli.Status()
+	assert.Equal(t, true, status.Running)
+	assert.Equal(t, false, status.Ready())
+
+	fake.change(getConfigParamKey(&param), `{"qps_limit":100}`)
+	// wait goroutine deal
+	time.Sleep(1 * time.Second)
+
+	states := cli.ConfigStates()
+	assert.Equal(t, 1, len(states))
+	assert.Equal(t, "k1", states[0].Key)
+	assert.Equal(t, "limit", states[0].Namespace)
+	assert.Equal(t, "limit", states[0].Category)
+	assert.Equal(t, "c1", states[0].Cluster)
+	assert.Equal(t, `{"qps_limit":100}`, states[0].RawValue)
+	assert.Equal(t, json.RawMessage(`{"qps_limit":100}`), states[0].Effective)
+	assert.Equal(t, []int64{id}, states[0].UniqueIDs)
+	assert.Equal(t, true, cli.Status().Ready())
+
+	cli.DeregisterConfig(param, id)
+	assert.Equal(t, 0, len(cli.ConfigStates()))
+}
+
+func TestClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	fake := NewFakeApollo()
+	cli := &client{
+		acli:     fake,
+		parser:   defaultConfigParse(),
+		stop:     make(chan bool),
+		handlers: make(map[configParamKey]map[int64]callbackHandler),
+		states:   newStateStore(),
+		metrics:  noopMetricsHook{},
+		status:   newSyncStatus(noopMetricsHook{}),
+	}
+
+	for _, ns := range []string{"n1", "n2"} {
+		err := cli.RegisterConfigCallback(ConfigParam{
+			Key:       "k1",
+			nameSpace: ns,
+			Cluster:   "c1",
+		}, func(s string, cp ConfigParser) error { return nil }, GetUniqueID())
+		assert.Equal(t, nil, err)
+	}
+	assert.Equal(t, 2, len(cli.ConfigStates()))
+	assert.Equal(t, true, cli.Status().Running)
+
+	assert.Equal(t, nil, cli.Close(context.Background()))
+	assert.Equal(t, 0, len(cli.ConfigStates()))
+	assert.Equal(t, false, cli.Status().Running)
+
+	err := cli.RegisterConfigCallback(ConfigParam{
+		Key:       "k1",
+		nameSpace: "n1",
+		Cluster:   "c1",
+	}, func(s string, cp ConfigParser) error { return nil }, GetUniqueID())
+	assert.Equal(t, ErrClientClosed, err)
+}
+
+func TestDeregisterLastConfig(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	fake := NewFakeApollo()
+	cli := &client{
+		acli:     fake,
+		parser:   defaultConfigParse(),
+		stop:     make(chan bool),
+		handlers: make(map[configParamKey]map[int64]callbackHandler),
+		states:   newStateStore(),
+		metrics:  noopMetricsHook{},
+		status:   newSyncStatus(noopMetricsHook{}),
+	}
+	param := ConfigParam{
+		Key:       "k1",
+		nameSpace: "n1",
+		Cluster:   "c1",
+	}
+	callback := func(s string, cp ConfigParser) error { return nil }
+
+	id := GetUniqueID()
+	assert.Equal(t, nil, cli.RegisterConfigCallback(param, callback, id))
+	assert.Equal(t, nil, cli.DeregisterConfig(param, id))
+
+	// the client is not closed by deregistering the last config
+	assert.Equal(t, true, cli.Status().Running)
+	id = GetUniqueID()
+	assert.Equal(t, nil, cli.RegisterConfigCallback(param, callback, id))
+	assert.Equal(t, 1, len(cli.ConfigStates()))
+
+	assert.Equal(t, nil, cli.Close(context.Background()))
+	assert.Equal(t, false, cli.Status().Running)
+}
+
+func TestCloseTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	fake := NewFakeApollo()
+	cli := &client{
+		acli:     fake,
+		parser:   defaultConfigParse(),
+		stop:     make(chan bool),
+		handlers: make(map[configParamKey]map[int64]callbackHandler),
+		states:   newStateStore(),
+		metrics:  noopMetricsHook{},
+		status:   newSyncStatus(noopMetricsHook{}),
+	}
+	param := ConfigParam{
+		Key:       "k1",
+		nameSpace: "n1",
+		Cluster:   "c1",
+	}
+
+	fake.Lock()
+	fake.len++
+	fake.Unlock()
+
+	block := make(chan struct{})
+	err := cli.RegisterConfigCallback(param, func(s string, cp ConfigParser) error {
+		<-block
+		return nil
+	}, GetUniqueID())
+	assert.Equal(t, nil, err)
+
+	// the listen goroutine blocks in the callback
+	fake.change(getConfigParamKey(&param), "change")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, cli.Close(ctx))
+
+	close(block)
+	assert.Equal(t, nil, cli.Close(context.Background()))
+}
+
+type countingMetricsHook struct {
+	noopMetricsHook
+	applied, decodeFailed, rejected int
+}
+
+func (h *countingMetricsHook) ConfigApplied(string)      { h.applied++ }
+func (h *countingMetricsHook) DecodeFailed(string)       { h.decodeFailed++ }
+func (h *countingMetricsHook) ValidationRejected(string) { h.rejected++ }
+
+func TestApplyConfigMetrics(t *testing.T) {
+	hook := &countingMetricsHook{}
+	cli := &client{
+		parser:  defaultConfigParse(),
+		states:  newStateStore(),
+		metrics: hook,
+	}
+	param := ConfigParam{Key: "k1", nameSpace: "limit", Cluster: "c1", Type: JSON, category: "limit"}
+	callback := func(s string, cp ConfigParser) error {
+		cfg := map[string]int{}
+		if err := cp.Decode(param.Type, s, &cfg); err != nil {
+			return err
+		}
+		if cfg["qps_limit"] < 0 {
+			return errors.New("invalid qps_limit")
+		}
+		return nil
+	}
+
+	cli.applyConfig(param, `{"qps_limit":100}`, callback)
+	assert.Equal(t, 1, hook.applied)
+
+	// the rejected config is not counted as applied
+	cli.applyConfig(param, `{"qps_limit":-1}`, callback)
+	assert.Equal(t, 1, hook.applied)
+	assert.Equal(t, 1, hook.rejected)
+
+	cli.applyConfig(param, `{"qps_limit":`, callback)
+	assert.Equal(t, 1, hook.applied)
+	assert.Equal(t, 1, hook.rejected)
+	assert.Equal(t, 1, hook.decodeFailed)
+}
+
+func TestConfigStatesEffective(t *testing.T) {
+	cli := &client{
+		parser:  defaultConfigParse(),
+		states:  newStateStore(),
+		metrics: noopMetricsHook{},
+	}
+	param := ConfigParam{Key: "k1", nameSpace: "limit", Cluster: "c1", Type: JSON, category: "limit"}
+	cli.states.register(param, GetUniqueID())
+
+	type limitConfig struct {
+		QPSLimit int            `json:"qps_limit"`
+		Methods  map[string]int `json:"methods"`
+	}
+	callback := func(s string, cp ConfigParser) error {
+		cfg := &limitConfig{}
+		if err := cp.Decode(param.Type, s, cfg); err != nil {
+			return err
+		}
+		if cfg.QPSLimit < 0 {
+			return errors.New("invalid qps_limit")
+		}
+		for method, limit := range cfg.Methods {
+			if limit < 0 {
+				delete(cfg.Methods, method)
+			}
+		}
+		// the parts of the document decoded later are not recorded
+		return cp.Decode(param.Type, `{"qps_limit":1}`, &limitConfig{})
+	}
+
+	// the unknown keys and the entries skipped by the callback are not effective
+	cli.applyConfig(param, `{"qps_limit":100,"methods":{"a":1,"b":-1},"unknown":true}`, callback)
+	effective := json.RawMessage(`{"qps_limit":100,"methods":{"a":1}}`)
+	assert.Equal(t, effective, cli.ConfigStates()[0].Effective)
+
+	// the rejected config is not effective
+	cli.applyConfig(param, `{"qps_limit":-1}`, callback)
+	assert.Equal(t, effective, cli.ConfigStates()[0].Effective)
+	cli.applyConfig(param, `{"qps_limit":`, callback)
+	assert.Equal(t, effective, cli.ConfigStates()[0].Effective)
+}
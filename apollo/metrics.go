@@ -0,0 +1,52 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apollo
+
+import "time"
+
+// MetricsHook reports the config sync health of the apollo client.
+// The methods are called in the config update path, so they must not block.
+type MetricsHook interface {
+	// ConfigReceived is called when a config value of the category is received.
+	ConfigReceived(category string)
+	// ConfigApplied is called when a config value of the category is applied by the callback.
+	ConfigApplied(category string)
+	// DecodeFailed is called when a config value of the category fails to decode.
+	DecodeFailed(category string)
+	// ValidationRejected is called when a decoded config of the category is rejected by validation, either
+	// the whole config by the callback or an entry of it skipped while the rest is applied.
+	ValidationRejected(category string)
+	// LongPollError is called when polling the namespace from the config server fails.
+	LongPollError(namespace string)
+	// Reconnected is called when polling the namespace succeeds again after errors.
+	Reconnected(namespace string)
+	// Synced is called when polling the namespace from the config server succeeds.
+	Synced(namespace string, t time.Time)
+	// ActiveSubscriptions is called with the number of the active subscriptions when it changes.
+	ActiveSubscriptions(n int)
+}
+
+var _ MetricsHook = noopMetricsHook{}
+
+type noopMetricsHook struct{}
+
+func (noopMetricsHook) ConfigReceived(string)     {}
+func (noopMetricsHook) ConfigApplied(string)      {}
+func (noopMetricsHook) DecodeFailed(string)       {}
+func (noopMetricsHook) ValidationRejected(string) {}
+func (noopMetricsHook) LongPollError(string)      {}
+func (noopMetricsHook) Reconnected(string)        {}
+func (noopMetricsHook) Synced(string, time.Time)  {}
+func (noopMetricsHook) ActiveSubscriptions(int)   {}
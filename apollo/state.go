@@ -0,0 +1,168 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apollo
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/cloudwego/kitex/pkg/klog"
+)
+
+// ConfigState the state of a registered ConfigParam, used for introspection. Effective is the JSON of
+// the config last applied by the callbacks, or null if none is applied.
+type ConfigState struct {
+	Key        string          `json:"key"`
+	Namespace  string          `json:"namespace"`
+	Cluster    string          `json:"cluster"`
+	Category   string          `json:"category"`
+	RawValue   string          `json:"raw_value"`
+	Effective  json.RawMessage `json:"effective"`
+	UpdateTime time.Time       `json:"update_time"`
+	UniqueIDs  []int64         `json:"unique_ids"`
+}
+
+type configState struct {
+	param      ConfigParam
+	rawValue   string
+	effective  json.RawMessage
+	updateTime time.Time
+	uniqueIDs  map[int64]struct{}
+}
+
+type stateStore struct {
+	sync.RWMutex
+	states map[configParamKey]*configState
+}
+
+func newStateStore() *stateStore {
+	return &stateStore{
+		states: make(map[configParamKey]*configState),
+	}
+}
+
+func (s *stateStore) register(param ConfigParam, uniqueID int64) {
+	key := getConfigParamKey(&param)
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.states[key]
+	if !ok {
+		st = &configState{
+			param:     param,
+			uniqueIDs: make(map[int64]struct{}),
+		}
+		s.states[key] = st
+	}
+	st.uniqueIDs[uniqueID] = struct{}{}
+}
+
+func (s *stateStore) deregister(key configParamKey, uniqueID int64) {
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.states[key]
+	if !ok {
+		return
+	}
+	delete(st.uniqueIDs, uniqueID)
+	if len(st.uniqueIDs) == 0 {
+		delete(s.states, key)
+	}
+}
+
+func (s *stateStore) updateRaw(key configParamKey, data string) {
+	s.Lock()
+	defer s.Unlock()
+	if st, ok := s.states[key]; ok {
+		st.rawValue = data
+		st.updateTime = time.Now()
+	}
+}
+
+// updateEffective records the config applied in JSON, which is a copy the callbacks can't change after.
+func (s *stateStore) updateEffective(key configParamKey, config interface{}) {
+	data, err := sonic.ConfigStd.Marshal(config)
+	if err != nil {
+		klog.Warnf("[apollo] marshal the effective config of %v failed: %s", key, err)
+		data = nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	if st, ok := s.states[key]; ok {
+		st.effective = data
+	}
+}
+
+// subscriptions returns the number of the registered uniqueIDs.
+func (s *stateStore) subscriptions() int {
+	s.RLock()
+	defer s.RUnlock()
+	n := 0
+	for _, st := range s.states {
+		n += len(st.uniqueIDs)
+	}
+	return n
+}
+
+// snapshot returns the states sorted by namespace, cluster and key.
+func (s *stateStore) snapshot() []ConfigState {
+	s.RLock()
+	out := make([]ConfigState, 0, len(s.states))
+	for _, st := range s.states {
+		ids := make([]int64, 0, len(st.uniqueIDs))
+		for id := range st.uniqueIDs {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		out = append(out, ConfigState{
+			Key:        st.param.Key,
+			Namespace:  st.param.nameSpace,
+			Cluster:    st.param.Cluster,
+			Category:   st.param.category,
+			RawValue:   st.rawValue,
+			Effective:  st.effective,
+			UpdateTime: st.updateTime,
+			UniqueIDs:  ids,
+		})
+	}
+	s.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		if out[i].Cluster != out[j].Cluster {
+			return out[i].Cluster < out[j].Cluster
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+var _ ConfigParser = &recordParser{}
+
+// recordParser records the decoded config as the effective config of the key.
+type recordParser struct {
+	ConfigParser
+	record func(config interface{}, err error)
+}
+
+// Decode decodes the data by the wrapped parser and records the result.
+func (p *recordParser) Decode(kind ConfigType, data string, config interface{}) error {
+	err := p.ConfigParser.Decode(kind, data, config)
+	p.record(config, err)
+	return err
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apollo
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/shima-park/agollo"
+)
+
+// Status the health status of the apollo client.
+type Status struct {
+	// Running reports whether the long poller is running.
+	Running bool `json:"running"`
+	// LastError the last error of fetching config from the config server.
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	// LastSync the last successful fetch time of every namespace.
+	LastSync map[string]time.Time `json:"last_sync"`
+	Keys     []KeyStatus          `json:"keys"`
+}
+
+// KeyStatus the load status of a registered key.
+type KeyStatus struct {
+	Key       string `json:"key"`
+	Namespace string `json:"namespace"`
+	Cluster   string `json:"cluster"`
+	// Loaded reports whether the value of the key has been received,
+	// or its namespace has been fetched successfully while the key is absent.
+	Loaded bool `json:"loaded"`
+}
+
+// Ready reports whether the long poller is running and all the registered keys have been loaded.
+func (s Status) Ready() bool {
+	if !s.Running {
+		return false
+	}
+	for _, k := range s.Keys {
+		if !k.Loaded {
+			return false
+		}
+	}
+	return true
+}
+
+type syncStatus struct {
+	sync.RWMutex
+	hook        MetricsHook
+	running     bool
+	lastErr     error
+	lastErrTime time.Time
+	lastSync    map[string]time.Time
+	failing     map[string]bool
+}
+
+func newSyncStatus(hook MetricsHook) *syncStatus {
+	return &syncStatus{
+		hook:     hook,
+		lastSync: make(map[string]time.Time),
+		failing:  make(map[string]bool),
+	}
+}
+
+func (s *syncStatus) setRunning(running bool) {
+	s.Lock()
+	s.running = running
+	s.Unlock()
+}
+
+// report records the fetch result of the namespace and reports it to the metrics hook.
+func (s *syncStatus) report(namespace string, err error) {
+	now := time.Now()
+	s.Lock()
+	failing := s.failing[namespace]
+	s.failing[namespace] = err != nil
+	if err != nil {
+		s.lastErr = err
+		s.lastErrTime = now
+	} else {
+		s.lastSync[namespace] = now
+	}
+	s.Unlock()
+
+	if err != nil {
+		s.hook.LongPollError(namespace)
+		return
+	}
+	if failing {
+		s.hook.Reconnected(namespace)
+	}
+	s.hook.Synced(namespace, now)
+}
+
+func (s *syncStatus) synced(namespace string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	_, ok := s.lastSync[namespace]
+	return ok
+}
+
+func (s *syncStatus) snapshot() Status {
+	s.RLock()
+	defer s.RUnlock()
+	st := Status{
+		Running:  s.running,
+		LastSync: make(map[string]time.Time, len(s.lastSync)),
+	}
+	if s.lastErr != nil {
+		st.LastError = s.lastErr.Error()
+		t := s.lastErrTime
+		st.LastErrorTime = &t
+	}
+	for ns, t := range s.lastSync {
+		st.LastSync[ns] = t
+	}
+	return st
+}
+
+// withSyncStatus wraps the apollo HTTP api to record the fetch result of every namespace.
+func withSyncStatus(status *syncStatus) agollo.Option {
+	return func(o *agollo.Options) {
+		o.ApolloClient = &observedApolloClient{
+			ApolloClient: o.ApolloClient,
+			status:       status,
+		}
+	}
+}
+
+type observedApolloClient struct {
+	agollo.ApolloClient
+	status *syncStatus
+}
+
+func (c *observedApolloClient) Notifications(configServerURL, appID, clusterName string,
+	notifications []agollo.Notification,
+) (int, []agollo.Notification, error) {
+	status, result, err := c.ApolloClient.Notifications(configServerURL, appID, clusterName, notifications)
+	for _, n := range notifications {
+		c.status.report(n.NamespaceName, checkStatus(status, err))
+	}
+	return status, result, err
+}
+
+func (c *observedApolloClient) GetConfigsFromNonCache(configServerURL, appID, cluster, namespace string,
+	opts ...agollo.NotificationsOption,
+) (int, *agollo.Config, error) {
+	status, config, err := c.ApolloClient.GetConfigsFromNonCache(configServerURL, appID, cluster, namespace, opts...)
+	c.status.report(namespace, checkStatus(status, err))
+	return status, config, err
+}
+
+func checkStatus(status int, err error) error {
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusNotModified {
+		return fmt.Errorf("unexpected response status %d", status)
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ package client
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/cloudwego/kitex/client"
 	"github.com/cloudwego/kitex/pkg/circuitbreak"
@@ -26,17 +27,45 @@ import (
 	"github.com/kitex-contrib/config-apollo/utils"
 )
 
+// InstanceCBKey the reserved key in the circuit breaker document for the instance level config,
+// which is keyed by the downstream address in kitex.
+const InstanceCBKey = "__instance__"
+
+// WildcardCBKey the key in the circuit breaker document for the default config of the methods
+// without explicit config.
+const WildcardCBKey = "*"
+
 // WithCircuitBreaker sets the circuit breaker policy from apollo configuration center.
+// It panics when failed, use WithCircuitBreakerE to handle the error.
 func WithCircuitBreaker(dest, src string, apolloClient apollo.Client,
 	opts utils.Options,
 ) []client.Option {
+	options, err := WithCircuitBreakerE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithCircuitBreakerE sets the circuit breaker policy from apollo configuration center.
+func WithCircuitBreakerE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
+	options, _, err := withCircuitBreaker(dest, src, apolloClient, opts)
+	return options, err
+}
+
+// withCircuitBreaker sets the circuit breaker policy and returns the circuit breaker suite.
+func withCircuitBreaker(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, *circuitbreak.CBSuite, error) {
 	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
 		Category:          apollo.CircuitBreakerConfigName,
 		ServerServiceName: dest,
 		ClientServiceName: src,
 	})
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
 	for _, f := range opts.ApolloCustomFunctions {
@@ -45,7 +74,10 @@ func WithCircuitBreaker(dest, src string, apolloClient apollo.Client,
 
 	uniqueID := apollo.GetUniqueID()
 
-	cbSuite := initCircuitBreaker(param, dest, src, apolloClient, uniqueID)
+	cbSuite, err := initCircuitBreaker(param, dest, src, apolloClient, uniqueID)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	return []client.Option{
 		client.WithCircuitBreaker(cbSuite),
@@ -57,16 +89,7 @@ func WithCircuitBreaker(dest, src string, apolloClient apollo.Client,
 			// cancel the configuration listener when client is closed.
 			return cbSuite.Close()
 		}),
-	}
-}
-
-// keep consistent when initialising the circuit breaker suit and updating
-// the circuit breaker policy.
-func genServiceCBKeyWithRPCInfo(ri rpcinfo.RPCInfo) string {
-	if ri == nil {
-		return ""
-	}
-	return genServiceCBKey(ri.To().ServiceName(), ri.To().Method())
+	}, cbSuite, nil
 }
 
 func genServiceCBKey(toService, method string) string {
@@ -79,35 +102,105 @@ func genServiceCBKey(toService, method string) string {
 	return buf.String()
 }
 
-func initCircuitBreaker(param apollo.ConfigParam, dest, src string,
-	apolloClient apollo.Client, uniqueID int64,
-) *circuitbreak.CBSuite {
-	cb := circuitbreak.NewCBSuite(genServiceCBKeyWithRPCInfo)
-	lcb := utils.ThreadSafeSet{}
-
-	onChangeCallback := func(data string, parser apollo.ConfigParser) {
-		set := utils.Set{}
-		configs := map[string]circuitbreak.CBConfig{}
-		err := parser.Decode(param.Type, data, &configs)
-		if err != nil {
-			klog.Warnf("[apollo] %s client apollo circuit breakr: unmarshal data %s failed: %s, skip...", dest, data, err)
-			return
+// cbConfigs applies the method configs to the circuit breaker suite. The wildcard
+// config applies to the methods without explicit config, including the methods
+// called for the first time after the config is applied.
+type cbConfigs struct {
+	dest string
+	cb   *circuitbreak.CBSuite
+
+	mu       sync.Mutex
+	known    sync.Map // method -> struct{}, the methods whose config has been set
+	explicit utils.Set
+	wildcard *circuitbreak.CBConfig
+	instance bool
+}
+
+// genServiceCBKey keep consistent when initialising the circuit breaker suit and updating
+// the circuit breaker policy. The config of a method is set here before the suite loads it
+// for the first time.
+func (c *cbConfigs) genServiceCBKey(ri rpcinfo.RPCInfo) string {
+	if ri == nil {
+		return ""
+	}
+	method := ri.To().Method()
+	if _, ok := c.known.Load(method); !ok {
+		c.mu.Lock()
+		if _, ok := c.known.Load(method); !ok {
+			if c.wildcard != nil {
+				c.cb.UpdateServiceCBConfig(genServiceCBKey(c.dest, method), *c.wildcard)
+			}
+			c.known.Store(method, struct{}{})
+		}
+		c.mu.Unlock()
+	}
+	return genServiceCBKey(ri.To().ServiceName(), method)
+}
+
+func (c *cbConfigs) update(configs map[string]circuitbreak.CBConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.explicit = utils.Set{}
+	c.wildcard = nil
+	instance := false
+	for method, config := range configs {
+		switch method {
+		case InstanceCBKey:
+			c.cb.UpdateInstanceCBConfig(config)
+			instance = true
+		case WildcardCBKey:
+			config := config
+			c.wildcard = &config
+		default:
+			c.explicit[method] = true
+			c.cb.UpdateServiceCBConfig(genServiceCBKey(c.dest, method), config)
+			c.known.Store(method, struct{}{})
 		}
+	}
+	if c.instance && !instance {
+		// For deleted instance config, set to default policy
+		c.cb.UpdateInstanceCBConfig(circuitbreak.GetDefaultCBConfig())
+	}
+	c.instance = instance
 
-		for method, config := range configs {
-			set[method] = true
-			key := genServiceCBKey(dest, method)
-			cb.UpdateServiceCBConfig(key, config)
+	// The methods without explicit config, including the deleted ones, fall back to
+	// the wildcard config or the default policy.
+	fallback := circuitbreak.GetDefaultCBConfig()
+	if c.wildcard != nil {
+		fallback = *c.wildcard
+	}
+	c.known.Range(func(key, _ interface{}) bool {
+		method := key.(string)
+		if !c.explicit[method] {
+			c.cb.UpdateServiceCBConfig(genServiceCBKey(c.dest, method), fallback)
 		}
+		return true
+	})
+}
 
-		for _, method := range lcb.DiffAndEmplace(set) {
-			key := genServiceCBKey(dest, method)
-			// For deleted method configs, set to default policy
-			cb.UpdateServiceCBConfig(key, circuitbreak.GetDefaultCBConfig())
+func initCircuitBreaker(param apollo.ConfigParam, dest, src string,
+	apolloClient apollo.Client, uniqueID int64,
+) (*circuitbreak.CBSuite, error) {
+	configs := &cbConfigs{dest: dest}
+	cb := circuitbreak.NewCBSuite(configs.genServiceCBKey)
+	configs.cb = cb
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		methodConfigs := map[string]circuitbreak.CBConfig{}
+		err := parser.Decode(param.Type, data, &methodConfigs)
+		if err != nil {
+			klog.Warnf("[apollo] %s client apollo circuit breakr: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
 		}
+		configs.update(methodConfigs)
+		return nil
 	}
 
-	apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID)
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		cb.Close()
+		return nil, err
+	}
 
-	return cb
+	return cb, nil
 }
@@ -0,0 +1,137 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/circuitbreak"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// serviceCBConfig returns the service circuit breaker config of the method set in the suite.
+func serviceCBConfig(cb *circuitbreak.CBSuite, method string) (circuitbreak.CBConfig, bool) {
+	configs := cb.Dump().(map[string]interface{})["cb_config"].(map[string]interface{})["service"].(map[string]interface{})
+	c, ok := configs[genServiceCBKey("svc", method)]
+	if !ok {
+		return circuitbreak.CBConfig{}, false
+	}
+	return c.(circuitbreak.CBConfig), true
+}
+
+// instanceCBConfig returns the instance circuit breaker config set in the suite.
+func instanceCBConfig(cb *circuitbreak.CBSuite) circuitbreak.CBConfig {
+	return cb.Dump().(map[string]interface{})["cb_config"].(map[string]interface{})["instance"].(circuitbreak.CBConfig)
+}
+
+// callMethod generates the circuit breaker key of the method as a call does.
+func callMethod(cb *circuitbreak.CBSuite, method string) string {
+	ctx := rpcinfo.NewCtxWithRPCInfo(context.Background(), newTestRPCInfo(method, nil))
+	key, _ := cb.ServiceControl().GetKey(ctx, nil)
+	return key
+}
+
+func TestCircuitBreakerWildcard(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.CircuitBreakerConfigName, `{
+		"*": {"enable": true, "err_rate": 0.3, "min_sample": 100},
+		"Echo": {"enable": true, "err_rate": 0.5, "min_sample": 200}
+	}`)
+	_, cb, err := withCircuitBreaker("svc", "cli", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+	defer cb.Close()
+
+	c, ok := serviceCBConfig(cb, "Echo")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, c.ErrRate, 0.5)
+
+	// the wildcard applies to the method called for the first time after the config arrives
+	_, ok = serviceCBConfig(cb, "Hello")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, callMethod(cb, "Hello"), genServiceCBKey("svc", "Hello"))
+	c, ok = serviceCBConfig(cb, "Hello")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, c.ErrRate, 0.3)
+	assert.Equal(t, c.MinSample, int64(100))
+
+	// the wildcard update applies to the known methods without explicit config
+	cli.Change(apollo.CircuitBreakerConfigName, `{
+		"*": {"enable": true, "err_rate": 0.4, "min_sample": 100},
+		"Echo": {"enable": true, "err_rate": 0.5, "min_sample": 200}
+	}`)
+	c, _ = serviceCBConfig(cb, "Hello")
+	assert.Equal(t, c.ErrRate, 0.4)
+	c, _ = serviceCBConfig(cb, "Echo")
+	assert.Equal(t, c.ErrRate, 0.5)
+}
+
+func TestCircuitBreakerDeleted(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.CircuitBreakerConfigName, `{"Echo": {"enable": true, "err_rate": 0.5, "min_sample": 200}}`)
+	_, cb, err := withCircuitBreaker("svc", "cli", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+	defer cb.Close()
+
+	c, _ := serviceCBConfig(cb, "Echo")
+	assert.Equal(t, c.ErrRate, 0.5)
+
+	// the deleted method goes back to the default policy
+	cli.Change(apollo.CircuitBreakerConfigName, `{}`)
+	c, _ = serviceCBConfig(cb, "Echo")
+	assert.Equal(t, c, circuitbreak.GetDefaultCBConfig())
+
+	// or the wildcard config if there is one
+	cli.Change(apollo.CircuitBreakerConfigName, `{"Echo": {"enable": true, "err_rate": 0.5, "min_sample": 200}}`)
+	cli.Change(apollo.CircuitBreakerConfigName, `{"*": {"enable": true, "err_rate": 0.3, "min_sample": 100}}`)
+	c, _ = serviceCBConfig(cb, "Echo")
+	assert.Equal(t, c.ErrRate, 0.3)
+}
+
+func TestCircuitBreakerInstance(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.CircuitBreakerConfigName, `{
+		"__instance__": {"enable": true, "err_rate": 0.6, "min_sample": 300},
+		"Echo": {"enable": true, "err_rate": 0.5, "min_sample": 200}
+	}`)
+	_, cb, err := withCircuitBreaker("svc", "cli", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+	defer cb.Close()
+
+	assert.Equal(t, instanceCBConfig(cb), circuitbreak.CBConfig{Enable: true, ErrRate: 0.6, MinSample: 300})
+	// the instance key is not a method
+	_, ok := serviceCBConfig(cb, InstanceCBKey)
+	assert.Equal(t, ok, false)
+
+	cli.Change(apollo.CircuitBreakerConfigName, `{
+		"__instance__": {"enable": true, "err_rate": 0.7, "min_sample": 300},
+		"Echo": {"enable": true, "err_rate": 0.5, "min_sample": 200}
+	}`)
+	assert.Equal(t, instanceCBConfig(cb), circuitbreak.CBConfig{Enable: true, ErrRate: 0.7, MinSample: 300})
+
+	// the deleted instance config falls back to the default policy
+	cli.Change(apollo.CircuitBreakerConfigName, `{
+		"Echo": {"enable": true, "err_rate": 0.5, "min_sample": 200}
+	}`)
+	assert.Equal(t, instanceCBConfig(cb), circuitbreak.GetDefaultCBConfig())
+	c, ok := serviceCBConfig(cb, "Echo")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, c.ErrRate, 0.5)
+}
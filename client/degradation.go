@@ -0,0 +1,118 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+
+	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// WithDegradation rejects the calls of the degraded methods by the config from apollo configuration center.
+// It panics when failed, use WithDegradationE to handle the error.
+func WithDegradation(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) []client.Option {
+	options, err := WithDegradationE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithDegradationE rejects the calls of the degraded methods by the config from apollo configuration center.
+func WithDegradationE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
+	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.DegradationConfigName,
+		ServerServiceName: dest,
+		ClientServiceName: src,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+
+	uniqueID := apollo.GetUniqueID()
+
+	container, err := initDegradationContainer(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []client.Option{
+		client.WithMiddleware(degradationMiddleware(container)),
+		client.WithCloseCallbacks(func() error {
+			// cancel the configuration listener when client is closed.
+			return apolloClient.DeregisterConfig(param, uniqueID)
+		}),
+	}, nil
+}
+
+func degradationMiddleware(container *utils.DegradationContainer) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			if ri := rpcinfo.GetRPCInfo(ctx); ri != nil {
+				if err := container.Reject(ri.To().Method()); err != nil {
+					return err
+				}
+			}
+			return next(ctx, req, resp)
+		}
+	}
+}
+
+func initDegradationContainer(param apollo.ConfigParam, dest string,
+	apolloClient apollo.Client, uniqueID int64,
+) (*utils.DegradationContainer, error) {
+	container := utils.NewDegradationContainer()
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		configs := map[string]*utils.DegradationConfig{}
+		err := parser.Decode(param.Type, data, &configs)
+		if err != nil {
+			klog.Warnf("[apollo] %s client apollo degradation: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		for method, cfg := range configs {
+			if cfg == nil {
+				delete(configs, method)
+				continue
+			}
+			if err := cfg.Validate(); err != nil {
+				klog.Warnf("[apollo] %s client degradation for method %s is invalid: %s, skip...", dest, method, err)
+				apolloClient.MetricsHook().ValidationRejected(apollo.DegradationConfigName)
+				delete(configs, method)
+			}
+		}
+		container.NotifyPolicyChange(configs)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+
+	return container, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex-examples/kitex_gen/api"
+	"github.com/cloudwego/kitex-examples/kitex_gen/api/echo"
+	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/server"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// countingEcho echoes the requests and counts them.
+type countingEcho struct {
+	calls int32
+}
+
+func (e *countingEcho) Echo(ctx context.Context, req *api.Request) (*api.Response, error) {
+	atomic.AddInt32(&e.calls, 1)
+	return &api.Response{Message: req.Message}, nil
+}
+
+// runEchoClient starts an echo server and returns a client with the options calling it.
+func runEchoClient(t *testing.T, handler api.Echo, opts ...client.Option) echo.Client {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	addr := ln.Addr()
+	ln.Close()
+
+	svr := echo.NewServer(handler, server.WithServiceAddr(addr))
+	go svr.Run()
+	t.Cleanup(func() { svr.Stop() })
+
+	cli, err := echo.NewClient("svc", append(opts, client.WithHostPorts(addr.String()))...)
+	assert.Equal(t, err, nil)
+	// wait for the server to listen
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr.String()); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cli
+}
+
+func TestDegradationBizStatusError(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.DegradationConfigName, `{"echo": {"enabled": true, "error_code": 1001, "message": "degraded"}}`)
+	opts, err := WithDegradationE("svc", "cli", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+	handler := &countingEcho{}
+	echoCli := runEchoClient(t, handler, opts...)
+
+	// the degraded calls are not sent
+	_, err = echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	bizErr, ok := kerrors.FromBizStatusError(err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, bizErr.BizStatusCode(), int32(1001))
+	assert.Equal(t, bizErr.BizMessage(), "degraded")
+	assert.Equal(t, atomic.LoadInt32(&handler.calls), int32(0))
+
+	// the calls are rejected by the plain error without error_code
+	cli.Change(apollo.DegradationConfigName, `{"*": {"enabled": true}}`)
+	_, err = echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	assert.Equal(t, errors.Is(err, utils.ErrDegraded), true)
+	assert.Equal(t, atomic.LoadInt32(&handler.calls), int32(0))
+
+	// the invalid and disabled configs are ignored
+	cli.Change(apollo.DegradationConfigName, `{"echo": {"enabled": true, "percentage": 101}, "*": {"enabled": false}}`)
+	resp, err := echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.Message, "hello")
+
+	cli.Change(apollo.DegradationConfigName, `{}`)
+	resp, err = echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.Message, "hello")
+	assert.Equal(t, atomic.LoadInt32(&handler.calls), int32(2))
+}
@@ -0,0 +1,343 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bytedance/sonic"
+	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/fallback"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	kutils "github.com/cloudwego/kitex/pkg/utils"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// wildcardMethod matches the methods without explicit config.
+const wildcardMethod = "*"
+
+// The error types caught by the fallback config.
+const (
+	FallbackErrorTimeout      = "timeout"
+	FallbackErrorCircuitBreak = "circuit_break"
+	FallbackErrorBiz          = "biz"
+	FallbackErrorAny          = "any"
+)
+
+// FallbackConfig the fallback config of a method, the key is method name and wildcard "*"
+// matches the methods without explicit config.
+type FallbackConfig struct {
+	Enable bool `json:"enable"`
+	// ErrorTypes the error types to catch, timeout and circuit_break by default.
+	ErrorTypes []string `json:"error_types"`
+	// Handler the name of the handler registered by RegisterFallbackHandler.
+	Handler string `json:"handler"`
+	// ResponseBuilder the name of the builder registered by RegisterFallbackResponse,
+	// which builds the response that Response is decoded into.
+	ResponseBuilder string `json:"response_builder"`
+	// Response the static response returned when falling back, which is decoded into the response
+	// built by ResponseBuilder with the parser of the document.
+	Response interface{} `json:"response"`
+}
+
+// FallbackResponseBuilder builds an empty real response of the method, e.g. `&echo.Response{}`.
+type FallbackResponseBuilder func() interface{}
+
+var (
+	fallbackMutex     sync.RWMutex
+	fallbackHandlers  = map[string]fallback.RealReqRespFunc{}
+	fallbackResponses = map[string]FallbackResponseBuilder{}
+)
+
+// RegisterFallbackHandler registers the fallback handler with name, which could be selected by the
+// handler of FallbackConfig. It should be called before the clients are created.
+func RegisterFallbackHandler(name string, handler fallback.RealReqRespFunc) {
+	fallbackMutex.Lock()
+	defer fallbackMutex.Unlock()
+	fallbackHandlers[name] = handler
+}
+
+// RegisterFallbackResponse registers the response builder with name, which could be selected by the
+// response_builder of FallbackConfig. It should be called before the clients are created.
+func RegisterFallbackResponse(name string, builder FallbackResponseBuilder) {
+	fallbackMutex.Lock()
+	defer fallbackMutex.Unlock()
+	fallbackResponses[name] = builder
+}
+
+func getFallbackHandler(name string) (fallback.RealReqRespFunc, bool) {
+	fallbackMutex.RLock()
+	defer fallbackMutex.RUnlock()
+	h, ok := fallbackHandlers[name]
+	return h, ok
+}
+
+func getFallbackResponse(name string) (FallbackResponseBuilder, bool) {
+	fallbackMutex.RLock()
+	defer fallbackMutex.RUnlock()
+	b, ok := fallbackResponses[name]
+	return b, ok
+}
+
+// fallbackRule the validated FallbackConfig.
+type fallbackRule struct {
+	errorTypes utils.Set
+	handler    fallback.RealReqRespFunc
+	builder    FallbackResponseBuilder
+	response   *fallbackResponse
+}
+
+// fallbackDocument decodes the static response of a method from the document with its parser,
+// so that it's decoded the same way as the rest of the document whatever the format is.
+// It's only used in the config callback, as the parser is not kept after the callback returns.
+type fallbackDocument struct {
+	method string
+	kind   apollo.ConfigType
+	data   string
+	parser apollo.ConfigParser
+}
+
+// decode decodes the response of the method into resp, which is a pointer to the response.
+func (d *fallbackDocument) decode(resp interface{}) error {
+	// the document is decoded into struct{ Method struct{ Response T } } with the tags of the method name
+	entry := reflect.StructOf([]reflect.StructField{{
+		Name: "Response",
+		Type: reflect.TypeOf(resp),
+		Tag:  `json:"response" yaml:"response"`,
+	}})
+	doc := reflect.StructOf([]reflect.StructField{{
+		Name: "Method",
+		Type: entry,
+		Tag:  reflect.StructTag(fmt.Sprintf(`json:%q yaml:%q`, d.method, d.method)),
+	}})
+	v := reflect.New(doc)
+	v.Elem().Field(0).Field(0).Set(reflect.ValueOf(resp))
+	return d.parser.Decode(d.kind, d.data, v.Interface())
+}
+
+// fallbackResponse the static response decoded once when the config changes, which is kept in JSON
+// to give every call its own copy, as the response may be modified by the caller.
+type fallbackResponse struct {
+	builder FallbackResponseBuilder
+	data    []byte
+}
+
+func newFallbackResponse(builder FallbackResponseBuilder, doc *fallbackDocument) (*fallbackResponse, error) {
+	resp := builder()
+	if err := doc.decode(resp); err != nil {
+		return nil, err
+	}
+	data, err := sonic.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &fallbackResponse{builder: builder, data: data}, nil
+}
+
+// copy returns a copy of the static response.
+func (r *fallbackResponse) copy() (interface{}, error) {
+	resp := r.builder()
+	if err := sonic.Unmarshal(r.data, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func newFallbackRule(cfg *FallbackConfig, doc *fallbackDocument) (*fallbackRule, error) {
+	r := &fallbackRule{errorTypes: utils.Set{}}
+	errorTypes := cfg.ErrorTypes
+	if len(errorTypes) == 0 {
+		errorTypes = []string{FallbackErrorTimeout, FallbackErrorCircuitBreak}
+	}
+	for _, t := range errorTypes {
+		switch t {
+		case FallbackErrorTimeout, FallbackErrorCircuitBreak, FallbackErrorBiz, FallbackErrorAny:
+			r.errorTypes[t] = true
+		default:
+			return nil, errors.New("unknown error type " + t)
+		}
+	}
+	if cfg.Handler != "" {
+		h, ok := getFallbackHandler(cfg.Handler)
+		if !ok {
+			return nil, errors.New("handler " + cfg.Handler + " is not registered")
+		}
+		r.handler = h
+		return r, nil
+	}
+	if cfg.ResponseBuilder == "" {
+		return nil, errors.New("handler and response_builder must not be empty at same time")
+	}
+	b, ok := getFallbackResponse(cfg.ResponseBuilder)
+	if !ok {
+		return nil, errors.New("response builder " + cfg.ResponseBuilder + " is not registered")
+	}
+	r.builder = b
+	if cfg.Response != nil {
+		// the response which does not fit the builder is rejected
+		response, err := newFallbackResponse(b, doc)
+		if err != nil {
+			return nil, err
+		}
+		r.response = response
+	}
+	return r, nil
+}
+
+func (r *fallbackRule) catch(err error) bool {
+	switch {
+	case r.errorTypes[FallbackErrorAny]:
+		return true
+	case kerrors.IsTimeoutError(err):
+		return r.errorTypes[FallbackErrorTimeout]
+	case errors.Is(err, kerrors.ErrCircuitBreak):
+		return r.errorTypes[FallbackErrorCircuitBreak]
+	}
+	_, isBiz := kerrors.FromBizStatusError(err)
+	return isBiz && r.errorTypes[FallbackErrorBiz]
+}
+
+func (r *fallbackRule) do(ctx context.Context, args kutils.KitexArgs, result kutils.KitexResult, err error) error {
+	if r.handler != nil {
+		return fallback.UnwrapHelper(r.handler)(ctx, args, result, err)
+	}
+	if r.response == nil {
+		result.SetSuccess(r.builder())
+		return nil
+	}
+	resp, err := r.response.copy()
+	if err != nil {
+		return err
+	}
+	result.SetSuccess(resp)
+	return nil
+}
+
+// WithFallback sets the fallback policy from apollo configuration center.
+// It panics when failed, use WithFallbackE to handle the error.
+func WithFallback(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) []client.Option {
+	options, err := WithFallbackE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithFallbackE sets the fallback policy from apollo configuration center.
+func WithFallbackE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
+	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.FallbackConfigName,
+		ServerServiceName: dest,
+		ClientServiceName: src,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+
+	uniqueID := apollo.GetUniqueID()
+
+	policy, err := initFallbackPolicy(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []client.Option{
+		client.WithFallback(policy),
+		client.WithCloseCallbacks(func() error {
+			// cancel the configuration listener when client is closed.
+			return apolloClient.DeregisterConfig(param, uniqueID)
+		}),
+	}, nil
+}
+
+func initFallbackPolicy(param apollo.ConfigParam, dest string,
+	apolloClient apollo.Client, uniqueID int64,
+) (*fallback.Policy, error) {
+	// method -> *fallbackRule, swapped as a whole when the config changes.
+	var rules atomic.Value
+	rules.Store(map[string]*fallbackRule{})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		configs := map[string]*FallbackConfig{}
+		err := parser.Decode(param.Type, data, &configs)
+		if err != nil {
+			klog.Warnf("[apollo] %s client apollo fallback: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		rs := make(map[string]*fallbackRule, len(configs))
+		for method, cfg := range configs {
+			if cfg == nil || !cfg.Enable {
+				continue
+			}
+			r, err := newFallbackRule(cfg, &fallbackDocument{
+				method: method,
+				kind:   param.Type,
+				data:   data,
+				parser: parser,
+			})
+			if err != nil {
+				klog.Warnf("[apollo] %s client fallback for method %s is invalid: %s, skip...", dest, method, err)
+				apolloClient.MetricsHook().ValidationRejected(apollo.FallbackConfigName)
+				delete(configs, method)
+				continue
+			}
+			rs[method] = r
+		}
+		rules.Store(rs)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+
+	return fallback.NewFallbackPolicy(func(ctx context.Context, args kutils.KitexArgs, result kutils.KitexResult, err error) error {
+		if err == nil {
+			return nil
+		}
+		rs := rules.Load().(map[string]*fallbackRule)
+		if len(rs) == 0 {
+			return err
+		}
+		var method string
+		if ri := rpcinfo.GetRPCInfo(ctx); ri != nil {
+			method = ri.To().Method()
+		}
+		r, ok := rs[method]
+		if !ok {
+			r, ok = rs[wildcardMethod]
+		}
+		if !ok || !r.catch(err) {
+			return err
+		}
+		return r.do(ctx, args, result, err)
+	}), nil
+}
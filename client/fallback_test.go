@@ -0,0 +1,162 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	kutils "github.com/cloudwego/kitex/pkg/utils"
+	"gopkg.in/go-playground/assert.v1"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+)
+
+type yamlParser struct{}
+
+func (yamlParser) Decode(kind apollo.ConfigType, data string, config interface{}) error {
+	return yaml.Unmarshal([]byte(data), config)
+}
+
+type echoResponse struct {
+	Message string `json:"message" yaml:"message"`
+}
+
+type echoResult struct {
+	Success *echoResponse
+}
+
+func (r *echoResult) GetResult() interface{} {
+	return r.Success
+}
+
+func (r *echoResult) SetSuccess(x interface{}) {
+	r.Success = x.(*echoResponse)
+}
+
+var _ kutils.KitexResult = &echoResult{}
+
+func TestFallbackStaticResponse(t *testing.T) {
+	RegisterFallbackResponse("echo_response", func() interface{} { return &echoResponse{} })
+
+	for _, tc := range []struct {
+		name   string
+		parser apollo.ConfigParser
+		kind   apollo.ConfigType
+		data   string
+	}{
+		{
+			name:   "json",
+			parser: apollotest.JSONParser{},
+			kind:   apollo.JSON,
+			data:   `{"Echo": {"enable": true, "response_builder": "echo_response", "response": {"message": "fallback"}}}`,
+		},
+		{
+			name:   "yaml",
+			parser: yamlParser{},
+			kind:   apollo.YAML,
+			// the fields of FallbackConfig without yaml tags are decoded by the lower-cased names
+			data: "Echo:\n  enable: true\n  responsebuilder: echo_response\n  response:\n    message: fallback\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			configs := map[string]*FallbackConfig{}
+			assert.Equal(t, tc.parser.Decode(tc.kind, tc.data, &configs), nil)
+			r, err := newFallbackRule(configs["Echo"], &fallbackDocument{
+				method: "Echo",
+				kind:   tc.kind,
+				data:   tc.data,
+				parser: tc.parser,
+			})
+			assert.Equal(t, err, nil)
+
+			ri := newTestRPCInfo("Echo", nil)
+			ctx := rpcinfo.NewCtxWithRPCInfo(context.Background(), ri)
+			result := &echoResult{}
+			assert.Equal(t, r.catch(kerrors.ErrRPCTimeout), true)
+			assert.Equal(t, r.do(ctx, nil, result, kerrors.ErrRPCTimeout), nil)
+			assert.Equal(t, result.Success.Message, "fallback")
+
+			// every call gets its own response
+			result.Success.Message = "modified"
+			another := &echoResult{}
+			assert.Equal(t, r.do(ctx, nil, another, kerrors.ErrRPCTimeout), nil)
+			assert.Equal(t, another.Success.Message, "fallback")
+		})
+	}
+}
+
+func TestFallbackResponseMismatch(t *testing.T) {
+	RegisterFallbackResponse("echo_response", func() interface{} { return &echoResponse{} })
+	data := `{"Echo": {"enable": true, "response_builder": "echo_response", "response": {"message": 1}}}`
+	configs := map[string]*FallbackConfig{}
+	assert.Equal(t, apollotest.JSONParser{}.Decode(apollo.JSON, data, &configs), nil)
+	_, err := newFallbackRule(configs["Echo"], &fallbackDocument{
+		method: "Echo",
+		kind:   apollo.JSON,
+		data:   data,
+		parser: apollotest.JSONParser{},
+	})
+	assert.NotEqual(t, err, nil)
+}
+
+// countingParser counts the decodes.
+type countingParser struct {
+	apollotest.JSONParser
+	decodes int32
+}
+
+func (p *countingParser) Decode(kind apollo.ConfigType, data string, config interface{}) error {
+	atomic.AddInt32(&p.decodes, 1)
+	return p.JSONParser.Decode(kind, data, config)
+}
+
+func TestFallbackResponseDecodedOnce(t *testing.T) {
+	RegisterFallbackResponse("echo_response", func() interface{} { return &echoResponse{} })
+	data := `{"Echo": {"enable": true, "response_builder": "echo_response", "response": {"message": "fallback"}}}`
+	parser := &countingParser{}
+	configs := map[string]*FallbackConfig{}
+	assert.Equal(t, parser.Decode(apollo.JSON, data, &configs), nil)
+	r, err := newFallbackRule(configs["Echo"], &fallbackDocument{
+		method: "Echo",
+		kind:   apollo.JSON,
+		data:   data,
+		parser: parser,
+	})
+	assert.Equal(t, err, nil)
+	decodes := atomic.LoadInt32(&parser.decodes)
+
+	// the calls copy the decoded response without the parser
+	ctx := rpcinfo.NewCtxWithRPCInfo(context.Background(), newTestRPCInfo("Echo", nil))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := &echoResult{}
+			assert.Equal(t, r.do(ctx, nil, result, kerrors.ErrRPCTimeout), nil)
+			assert.Equal(t, result.Success.Message, "fallback")
+			result.Success.Message = "modified"
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, atomic.LoadInt32(&parser.decodes), decodes)
+}
@@ -0,0 +1,441 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/gopkg/cloud/metainfo"
+	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/loadbalance"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// The load balance strategies.
+const (
+	// LoadBalanceWeightedRoundRobin the weighted round robin, the default strategy.
+	LoadBalanceWeightedRoundRobin = "weighted_round_robin"
+	// LoadBalanceWeightedRandom the weighted random.
+	LoadBalanceWeightedRandom = "weighted_random"
+	// LoadBalanceInterleaved the interleaved weighted round robin.
+	LoadBalanceInterleaved = "interleaved"
+	// LoadBalanceConsistentHash the consistent hash by the key of the key source.
+	LoadBalanceConsistentHash = "consistent_hash"
+)
+
+// The built-in key sources of the consistent hash.
+const (
+	// HashKeySourceMethod hashes by the method name.
+	HashKeySourceMethod = "method"
+	// HashKeySourceMetainfo hashes by the metainfo value of the key, transient or persistent.
+	HashKeySourceMetainfo = "metainfo"
+)
+
+// ConsistentHashConfig the options of the consistent hash.
+type ConsistentHashConfig struct {
+	// KeySource method, metainfo or the name registered by RegisterHashKeyFunc.
+	KeySource string `json:"key_source"`
+	// Key the metainfo key when the key source is metainfo.
+	Key string `json:"key"`
+	// Replica the number of the replicas used when the primary node fails.
+	Replica uint32 `json:"replica"`
+	// VirtualFactor the number of the virtual nodes of each node, 100 by default.
+	VirtualFactor uint32 `json:"virtual_factor"`
+	// Weighted generates Weight * VirtualFactor virtual nodes for each node, true by default.
+	Weighted *bool `json:"weighted"`
+	// ExpireMS the expiry of the cached keys, 2 minutes by default.
+	ExpireMS int64 `json:"expire_ms"`
+}
+
+// LoadBalanceConfig the load balance strategy and the weight overrides of the downstream.
+type LoadBalanceConfig struct {
+	// Strategy weighted_round_robin, weighted_random, interleaved or consistent_hash,
+	// weighted_round_robin by default.
+	Strategy       string                `json:"strategy"`
+	ConsistentHash *ConsistentHashConfig `json:"consistent_hash"`
+	// Weights overrides the weight of the instances by address, 0 removes the instance.
+	Weights map[string]int `json:"weights"`
+	// TagWeights overrides the weight of the instances by tag in the form of key=value, 0 removes the
+	// instances. The weight of the address takes precedence.
+	TagWeights map[string]int `json:"tag_weights"`
+}
+
+// Validate checks the config.
+func (c *LoadBalanceConfig) Validate() error {
+	switch c.Strategy {
+	case "", LoadBalanceWeightedRoundRobin, LoadBalanceWeightedRandom, LoadBalanceInterleaved:
+	case LoadBalanceConsistentHash:
+		if c.ConsistentHash == nil {
+			return fmt.Errorf("consistent_hash is required by strategy %s", c.Strategy)
+		}
+		if _, err := c.ConsistentHash.keyFunc(); err != nil {
+			return err
+		}
+		if c.ConsistentHash.ExpireMS < 0 {
+			return fmt.Errorf("expire_ms must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown strategy %s", c.Strategy)
+	}
+	for addr, w := range c.Weights {
+		if w < 0 {
+			return fmt.Errorf("weight of %s must not be negative", addr)
+		}
+	}
+	for tag, w := range c.TagWeights {
+		if !strings.Contains(tag, "=") {
+			return fmt.Errorf("tag %s is not in the form of key=value", tag)
+		}
+		if w < 0 {
+			return fmt.Errorf("weight of tag %s must not be negative", tag)
+		}
+	}
+	return nil
+}
+
+var (
+	hashKeyMutex sync.RWMutex
+	hashKeyFuncs = map[string]loadbalance.KeyFunc{}
+)
+
+// RegisterHashKeyFunc registers the key func of the consistent hash with name, which could be selected
+// by the key_source of ConsistentHashConfig. It should be called before the clients are created.
+func RegisterHashKeyFunc(name string, f loadbalance.KeyFunc) {
+	hashKeyMutex.Lock()
+	defer hashKeyMutex.Unlock()
+	hashKeyFuncs[name] = f
+}
+
+func getHashKeyFunc(name string) (loadbalance.KeyFunc, bool) {
+	hashKeyMutex.RLock()
+	defer hashKeyMutex.RUnlock()
+	f, ok := hashKeyFuncs[name]
+	return f, ok
+}
+
+func (c *ConsistentHashConfig) keyFunc() (loadbalance.KeyFunc, error) {
+	switch c.KeySource {
+	case HashKeySourceMethod:
+		return func(ctx context.Context, request interface{}) string {
+			if ri := rpcinfo.GetRPCInfo(ctx); ri != nil {
+				return ri.To().Method()
+			}
+			return ""
+		}, nil
+	case HashKeySourceMetainfo:
+		if c.Key == "" {
+			return nil, fmt.Errorf("key is required by key_source %s", c.KeySource)
+		}
+		key := c.Key
+		return func(ctx context.Context, request interface{}) string {
+			v, _ := metainfoValue(ctx, key)
+			return v
+		}, nil
+	}
+	if f, ok := getHashKeyFunc(c.KeySource); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown key_source %s", c.KeySource)
+}
+
+// metainfoValue returns the transient value of the key, or the persistent one.
+func metainfoValue(ctx context.Context, key string) (string, bool) {
+	if v, ok := metainfo.GetValue(ctx, key); ok {
+		return v, true
+	}
+	return metainfo.GetPersistentValue(ctx, key)
+}
+
+// sameBalancer reports whether the configs build the same balancer, so it could be kept when only
+// the weights change.
+func sameBalancer(a, b *LoadBalanceConfig) bool {
+	if a.Strategy != b.Strategy {
+		return false
+	}
+	if a.Strategy != LoadBalanceConsistentHash {
+		return true
+	}
+	x, y := *a.ConsistentHash, *b.ConsistentHash
+	if x.weighted() != y.weighted() {
+		return false
+	}
+	x.Weighted, y.Weighted = nil, nil
+	return x == y
+}
+
+func (c *ConsistentHashConfig) weighted() bool {
+	return c.Weighted == nil || *c.Weighted
+}
+
+func newBalancer(c *LoadBalanceConfig) loadbalance.Loadbalancer {
+	switch c.Strategy {
+	case LoadBalanceWeightedRandom:
+		return loadbalance.NewWeightedRandomBalancer()
+	case LoadBalanceInterleaved:
+		return loadbalance.NewInterleavedWeightedRoundRobinBalancer()
+	case LoadBalanceConsistentHash:
+		// the key func is checked by Validate
+		f, _ := c.ConsistentHash.keyFunc()
+		opt := loadbalance.NewConsistentHashOption(f)
+		opt.Replica = c.ConsistentHash.Replica
+		opt.Weighted = c.ConsistentHash.weighted()
+		if c.ConsistentHash.VirtualFactor > 0 {
+			opt.VirtualFactor = c.ConsistentHash.VirtualFactor
+		}
+		if c.ConsistentHash.ExpireMS > 0 {
+			opt.ExpireDuration = time.Duration(c.ConsistentHash.ExpireMS) * time.Millisecond
+		}
+		return loadbalance.NewConsistBalancer(opt)
+	}
+	return loadbalance.NewWeightedRoundRobinBalancer()
+}
+
+// WithLoadBalancer selects the load balance strategy and overrides the weights of the instances by
+// the config from apollo configuration center.
+// It panics when failed, use WithLoadBalancerE to handle the error.
+func WithLoadBalancer(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) []client.Option {
+	options, err := WithLoadBalancerE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithLoadBalancerE selects the load balance strategy and overrides the weights of the instances by
+// the config from apollo configuration center.
+func WithLoadBalancerE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
+	options, _, err := withLoadBalancer(dest, src, apolloClient, opts)
+	return options, err
+}
+
+// withLoadBalancer sets the load balancer and returns it, so the routing could be built upon it.
+func withLoadBalancer(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, loadbalance.Loadbalancer, error) {
+	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.LoadBalanceConfigName,
+		ServerServiceName: dest,
+		ClientServiceName: src,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+
+	uniqueID := apollo.GetUniqueID()
+
+	lb, err := initLoadBalancer(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []client.Option{
+		client.WithLoadBalancer(lb),
+		client.WithCloseCallbacks(func() error {
+			// cancel the configuration listener when client is closed.
+			return apolloClient.DeregisterConfig(param, uniqueID)
+		}),
+	}, lb, nil
+}
+
+// weightedInstance overrides the weight of the instance.
+type weightedInstance struct {
+	discovery.Instance
+	weight int
+}
+
+// Weight implements discovery.Instance.
+func (i *weightedInstance) Weight() int {
+	return i.weight
+}
+
+// balancedResult the discovery result and the one with the weights overridden.
+type balancedResult struct {
+	src discovery.Result
+	out discovery.Result
+}
+
+// lbState the balancer and the config, replaced as a whole when the config changes.
+type lbState struct {
+	config   *LoadBalanceConfig
+	balancer loadbalance.Loadbalancer
+	results  sync.Map // cache key -> *balancedResult
+}
+
+// weight returns the overridden weight of the instance.
+func (s *lbState) weight(ins discovery.Instance) int {
+	if w, ok := s.config.Weights[ins.Address().String()]; ok {
+		return w
+	}
+	for tag, w := range s.config.TagWeights {
+		k, v, _ := strings.Cut(tag, "=")
+		if value, ok := ins.Tag(k); ok && value == v {
+			return w
+		}
+	}
+	return ins.Weight()
+}
+
+// apply overrides the weights of the result, the instances with zero weight are removed.
+func (s *lbState) apply(res discovery.Result) discovery.Result {
+	if len(s.config.Weights) == 0 && len(s.config.TagWeights) == 0 {
+		return res
+	}
+	out := res
+	out.Instances = make([]discovery.Instance, 0, len(res.Instances))
+	for _, ins := range res.Instances {
+		w := s.weight(ins)
+		switch {
+		case w <= 0:
+		case w == ins.Weight():
+			out.Instances = append(out.Instances, ins)
+		default:
+			out.Instances = append(out.Instances, &weightedInstance{Instance: ins, weight: w})
+		}
+	}
+	return out
+}
+
+// apolloLoadBalancer the load balancer whose strategy and weights are updated by the config, the
+// pickers are rebuilt when the config changes.
+type apolloLoadBalancer struct {
+	name  string
+	state atomic.Value // *lbState
+
+	mu sync.Mutex
+}
+
+var (
+	_ loadbalance.Loadbalancer = &apolloLoadBalancer{}
+	_ loadbalance.Rebalancer   = &apolloLoadBalancer{}
+)
+
+// GetPicker implements loadbalance.Loadbalancer.
+func (lb *apolloLoadBalancer) GetPicker(res discovery.Result) loadbalance.Picker {
+	st := lb.state.Load().(*lbState)
+	if !res.Cacheable {
+		return st.balancer.GetPicker(st.apply(res))
+	}
+	if r, ok := st.results.Load(res.CacheKey); ok {
+		return st.balancer.GetPicker(r.(*balancedResult).out)
+	}
+	r := &balancedResult{src: res, out: st.apply(res)}
+	st.results.Store(res.CacheKey, r)
+	return st.balancer.GetPicker(r.out)
+}
+
+// Rebalance implements loadbalance.Rebalancer.
+func (lb *apolloLoadBalancer) Rebalance(change discovery.Change) {
+	if !change.Result.Cacheable {
+		return
+	}
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	st := lb.state.Load().(*lbState)
+	r := &balancedResult{src: change.Result, out: st.apply(change.Result)}
+	st.results.Store(change.Result.CacheKey, r)
+	if rb, ok := st.balancer.(loadbalance.Rebalancer); ok {
+		change.Result = r.out
+		rb.Rebalance(change)
+	}
+}
+
+// Delete implements loadbalance.Rebalancer.
+func (lb *apolloLoadBalancer) Delete(change discovery.Change) {
+	if !change.Result.Cacheable {
+		return
+	}
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	st := lb.state.Load().(*lbState)
+	st.results.Delete(change.Result.CacheKey)
+	if rb, ok := st.balancer.(loadbalance.Rebalancer); ok {
+		rb.Delete(change)
+	}
+}
+
+// Name implements loadbalance.Loadbalancer. It contains the uniqueID of the config listener, as kitex
+// caches the balancer factories by name and the clients of the same destination must not share one.
+func (lb *apolloLoadBalancer) Name() string {
+	return lb.name
+}
+
+// update replaces the config, the balancer is kept when only the weights change and its pickers are
+// rebuilt with the known results.
+func (lb *apolloLoadBalancer) update(c *LoadBalanceConfig) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	old := lb.state.Load().(*lbState)
+	st := &lbState{config: c, balancer: old.balancer}
+	keep := sameBalancer(old.config, c)
+	if !keep {
+		st.balancer = newBalancer(c)
+	}
+	old.results.Range(func(key, value interface{}) bool {
+		src := value.(*balancedResult).src
+		r := &balancedResult{src: src, out: st.apply(src)}
+		st.results.Store(key, r)
+		if rb, ok := st.balancer.(loadbalance.Rebalancer); ok && keep {
+			rb.Rebalance(discovery.Change{Result: r.out})
+		}
+		return true
+	})
+	lb.state.Store(st)
+}
+
+func initLoadBalancer(param apollo.ConfigParam, dest string,
+	apolloClient apollo.Client, uniqueID int64,
+) (*apolloLoadBalancer, error) {
+	lb := &apolloLoadBalancer{name: fmt.Sprintf("apollo:%s/%s#%d", param.Cluster, param.Key, uniqueID)}
+	initial := &LoadBalanceConfig{}
+	lb.state.Store(&lbState{config: initial, balancer: newBalancer(initial)})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		cfg := &LoadBalanceConfig{}
+		err := parser.Decode(param.Type, data, cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s client apollo load balance: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			klog.Warnf("[apollo] %s client load balance config is invalid: %s, skip...", dest, err)
+			return err
+		}
+		lb.update(cfg)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+
+	return lb, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/loadbalance"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+)
+
+func newTestLoadBalancer(t *testing.T, cli *apollotest.Client) *apolloLoadBalancer {
+	param, err := cli.ClientConfigParam(&apollo.ConfigParamConfig{Category: apollo.LoadBalanceConfigName})
+	assert.Equal(t, err, nil)
+	lb, err := initLoadBalancer(param, "svc", cli, apollo.GetUniqueID())
+	assert.Equal(t, err, nil)
+	return lb
+}
+
+func newTestResult(addrs ...string) discovery.Result {
+	res := discovery.Result{Cacheable: true, CacheKey: "svc"}
+	for _, addr := range addrs {
+		res.Instances = append(res.Instances, discovery.NewInstance("tcp", addr, 10, map[string]string{"env": addr}))
+	}
+	return res
+}
+
+func currentBalancer(lb *apolloLoadBalancer) loadbalance.Loadbalancer {
+	return lb.state.Load().(*lbState).balancer
+}
+
+func TestLoadBalancerName(t *testing.T) {
+	cli := apollotest.NewClient()
+	// the balancers of the clients calling the same destination are not shared by kitex
+	assert.NotEqual(t, newTestLoadBalancer(t, cli).Name(), newTestLoadBalancer(t, cli).Name())
+}
+
+func TestLoadBalancerSwap(t *testing.T) {
+	cli := apollotest.NewClient()
+	lb := newTestLoadBalancer(t, cli)
+	res := newTestResult("127.0.0.1:1", "127.0.0.1:2")
+	lb.Rebalance(discovery.Change{Result: res})
+	assert.Equal(t, currentBalancer(lb).Name(), "weight_round_robin")
+
+	cli.Change(apollo.LoadBalanceConfigName, `{"strategy": "weighted_random"}`)
+	assert.Equal(t, currentBalancer(lb).Name(), "weight_random")
+	assert.NotEqual(t, lb.GetPicker(res).Next(context.Background(), nil), nil)
+
+	cli.Change(apollo.LoadBalanceConfigName, `{"strategy": "consistent_hash", "consistent_hash": {"key_source": "method"}}`)
+	assert.Equal(t, currentBalancer(lb).Name(), "consist")
+
+	// the balancer is kept when only the weights change
+	balancer := currentBalancer(lb)
+	cli.Change(apollo.LoadBalanceConfigName,
+		`{"strategy": "consistent_hash", "consistent_hash": {"key_source": "method"}, "weights": {"127.0.0.1:1": 0}}`)
+	assert.Equal(t, currentBalancer(lb) == balancer, true)
+	ctx := rpcinfo.NewCtxWithRPCInfo(context.Background(), newTestRPCInfo("echo", nil))
+	for i := 0; i < 10; i++ {
+		ins := lb.GetPicker(res).Next(ctx, nil)
+		assert.Equal(t, ins.Address().String(), "127.0.0.1:2")
+	}
+
+	// the invalid config is skipped
+	cli.Change(apollo.LoadBalanceConfigName, `{"strategy": "unknown"}`)
+	assert.Equal(t, currentBalancer(lb) == balancer, true)
+}
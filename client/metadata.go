@@ -0,0 +1,159 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/bytedance/gopkg/cloud/metainfo"
+	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// MetadataEntry a metainfo key/value pair attached to the outbound calls.
+type MetadataEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Persistent attaches the value as a persistent one, which is passed along the whole call chain,
+	// or as a transient one by default.
+	Persistent bool `json:"persistent"`
+	// IfAbsent only fills the key when the caller hasn't set it.
+	IfAbsent bool `json:"if_absent"`
+}
+
+// MetadataConfig the metainfo entries of a method, the key of the config is the method name and
+// wildcard "*" applies to every method without explicit config.
+type MetadataConfig []*MetadataEntry
+
+// Validate checks the config.
+func (c MetadataConfig) Validate() error {
+	for i, e := range c {
+		if e == nil {
+			return fmt.Errorf("entry %d is empty", i)
+		}
+		if e.Key == "" {
+			return fmt.Errorf("key of entry %d is empty", i)
+		}
+	}
+	return nil
+}
+
+// WithMetadata attaches the metainfo values to the outbound calls by the config from apollo configuration center.
+// It panics when failed, use WithMetadataE to handle the error.
+func WithMetadata(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) []client.Option {
+	options, err := WithMetadataE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithMetadataE attaches the metainfo values to the outbound calls by the config from apollo configuration center.
+func WithMetadataE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
+	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.MetadataConfigName,
+		ServerServiceName: dest,
+		ClientServiceName: src,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+
+	uniqueID := apollo.GetUniqueID()
+
+	var configs atomic.Value // map[string]MetadataConfig
+	configs.Store(map[string]MetadataConfig{})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		mc := map[string]MetadataConfig{}
+		err := parser.Decode(param.Type, data, &mc)
+		if err != nil {
+			klog.Warnf("[apollo] %s client apollo metadata: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		for method, c := range mc {
+			if err := c.Validate(); err != nil {
+				klog.Warnf("[apollo] %s client metadata for method %s is invalid: %s, skip...", dest, method, err)
+				apolloClient.MetricsHook().ValidationRejected(apollo.MetadataConfigName)
+				delete(mc, method)
+			}
+		}
+		configs.Store(mc)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+
+	return []client.Option{
+		client.WithMiddleware(metadataMiddleware(&configs)),
+		client.WithCloseCallbacks(func() error {
+			// cancel the configuration listener when client is closed.
+			return apolloClient.DeregisterConfig(param, uniqueID)
+		}),
+	}, nil
+}
+
+func metadataMiddleware(configs *atomic.Value) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			mc := configs.Load().(map[string]MetadataConfig)
+			if len(mc) == 0 {
+				return next(ctx, req, resp)
+			}
+			ri := rpcinfo.GetRPCInfo(ctx)
+			if ri == nil {
+				return next(ctx, req, resp)
+			}
+			entries, ok := mc[ri.To().Method()]
+			if !ok {
+				entries = mc[wildcardMethod]
+			}
+			for _, e := range entries {
+				if e.Persistent {
+					if e.IfAbsent {
+						if _, exist := metainfo.GetPersistentValue(ctx, e.Key); exist {
+							continue
+						}
+					}
+					ctx = metainfo.WithPersistentValue(ctx, e.Key, e.Value)
+					continue
+				}
+				if e.IfAbsent {
+					if _, exist := metainfo.GetValue(ctx, e.Key); exist {
+						continue
+					}
+				}
+				ctx = metainfo.WithValue(ctx, e.Key, e.Value)
+			}
+			return next(ctx, req, resp)
+		}
+	}
+}
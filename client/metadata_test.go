@@ -0,0 +1,112 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bytedance/gopkg/cloud/metainfo"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+)
+
+// callWithMetadata calls the method through the metadata middleware with the config and
+// returns the context passed to the next endpoint.
+func callWithMetadata(t *testing.T, ctx context.Context, data, method string) context.Context {
+	mc := map[string]MetadataConfig{}
+	assert.Equal(t, apollotest.JSONParser{}.Decode(apollo.JSON, data, &mc), nil)
+	var configs atomic.Value
+	configs.Store(mc)
+
+	var got context.Context
+	ep := metadataMiddleware(&configs)(func(ctx context.Context, req, resp interface{}) error {
+		got = ctx
+		return nil
+	})
+	assert.Equal(t, ep(rpcinfo.NewCtxWithRPCInfo(ctx, newTestRPCInfo(method, nil)), nil, nil), nil)
+	return got
+}
+
+func TestMetadataTransientAndPersistent(t *testing.T) {
+	ctx := callWithMetadata(t, context.Background(), `{"Echo": [
+		{"key": "env", "value": "canary"},
+		{"key": "feature_x", "value": "on", "persistent": true}
+	]}`, "Echo")
+
+	v, ok := metainfo.GetValue(ctx, "env")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, v, "canary")
+	_, ok = metainfo.GetPersistentValue(ctx, "env")
+	assert.Equal(t, ok, false)
+
+	v, ok = metainfo.GetPersistentValue(ctx, "feature_x")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, v, "on")
+	_, ok = metainfo.GetValue(ctx, "feature_x")
+	assert.Equal(t, ok, false)
+}
+
+func TestMetadataIfAbsent(t *testing.T) {
+	data := `{"Echo": [
+		{"key": "env", "value": "canary", "if_absent": true},
+		{"key": "feature_x", "value": "on", "persistent": true, "if_absent": true},
+		{"key": "region", "value": "hl"}
+	]}`
+	ctx := metainfo.WithValue(context.Background(), "env", "prod")
+	ctx = metainfo.WithPersistentValue(ctx, "feature_x", "off")
+	ctx = metainfo.WithValue(ctx, "region", "lf")
+	ctx = callWithMetadata(t, ctx, data, "Echo")
+
+	// the values set by the caller are kept with if_absent
+	v, _ := metainfo.GetValue(ctx, "env")
+	assert.Equal(t, v, "prod")
+	v, _ = metainfo.GetPersistentValue(ctx, "feature_x")
+	assert.Equal(t, v, "off")
+	// and overwritten without it
+	v, _ = metainfo.GetValue(ctx, "region")
+	assert.Equal(t, v, "hl")
+
+	// the absent values are filled
+	ctx = callWithMetadata(t, context.Background(), data, "Echo")
+	v, _ = metainfo.GetValue(ctx, "env")
+	assert.Equal(t, v, "canary")
+	v, _ = metainfo.GetPersistentValue(ctx, "feature_x")
+	assert.Equal(t, v, "on")
+}
+
+func TestMetadataWildcard(t *testing.T) {
+	data := `{
+		"*": [{"key": "env", "value": "default"}],
+		"Echo": [{"key": "env", "value": "canary"}]
+	}`
+	ctx := callWithMetadata(t, context.Background(), data, "Echo")
+	v, _ := metainfo.GetValue(ctx, "env")
+	assert.Equal(t, v, "canary")
+
+	// the methods without explicit config use the wildcard
+	ctx = callWithMetadata(t, context.Background(), data, "Hello")
+	v, _ = metainfo.GetValue(ctx, "env")
+	assert.Equal(t, v, "default")
+
+	// nothing is attached without the wildcard
+	ctx = callWithMetadata(t, context.Background(), `{"Echo": [{"key": "env", "value": "canary"}]}`, "Hello")
+	_, ok := metainfo.GetValue(ctx, "env")
+	assert.Equal(t, ok, false)
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/kitex-examples/kitex_gen/api"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+func TestPayloadLimitMiddleware(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.PayloadLimitConfigName, `{"Echo": {"max_request_bytes": 64, "max_response_bytes": 64}}`)
+	container, err := initPayloadLimitContainer(apollo.ConfigParam{Key: apollo.PayloadLimitConfigName, Type: apollo.JSON},
+		"svc", cli, apollo.GetUniqueID())
+	assert.Equal(t, err, nil)
+	called := 0
+	ep := payloadLimitMiddleware(container)(func(ctx context.Context, req, resp interface{}) error {
+		called++
+		return nil
+	})
+	ctx := rpcinfo.NewCtxWithRPCInfo(context.Background(), newTestRPCInfo("Echo", nil))
+
+	assert.Equal(t, ep(ctx, &api.Request{Message: "hello"}, &api.Response{Message: "hello"}), nil)
+	assert.Equal(t, called, 1)
+
+	// the request over the limit is not sent
+	err = ep(ctx, &api.Request{Message: strings.Repeat("x", 128)}, &api.Response{})
+	assert.Equal(t, errors.Is(err, utils.ErrPayloadTooLarge), true)
+	assert.Equal(t, called, 1)
+
+	// the unknown sizes fail instead of skipping the limit
+	err = ep(ctx, struct{}{}, &api.Response{})
+	assert.Equal(t, errors.Is(err, utils.ErrPayloadSizeUnknown), true)
+	assert.Equal(t, called, 1)
+	err = ep(ctx, &api.Request{Message: "hello"}, struct{}{})
+	assert.Equal(t, errors.Is(err, utils.ErrPayloadSizeUnknown), true)
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// The modes when the rate limit is exceeded.
+const (
+	// RateLimitModeReject rejects the call immediately.
+	RateLimitModeReject = "reject"
+	// RateLimitModeWait waits for the token up to max_wait_ms or the deadline of the call.
+	RateLimitModeWait = "wait"
+)
+
+// RateLimitConfig the rate limit config of a method, the key is method name and wildcard "*"
+// applies to every method without explicit config, each method has its own token bucket.
+type RateLimitConfig struct {
+	// QPS the token rate, no limit if it's not positive.
+	QPS float64 `json:"qps"`
+	// Burst the bucket size, ceil(qps) by default.
+	Burst int `json:"burst"`
+	// Mode reject or wait, reject by default.
+	Mode string `json:"mode"`
+	// MaxWaitMS the max time to wait for a token in wait mode.
+	MaxWaitMS int64 `json:"max_wait_ms"`
+}
+
+// Validate checks the config.
+func (c *RateLimitConfig) Validate() error {
+	switch c.Mode {
+	case "", RateLimitModeReject, RateLimitModeWait:
+	default:
+		return fmt.Errorf("unknown mode %s", c.Mode)
+	}
+	if c.Burst < 0 || c.MaxWaitMS < 0 {
+		return fmt.Errorf("burst and max_wait_ms must not be negative")
+	}
+	return nil
+}
+
+// WithRateLimiter limits the outbound QPS per method by the config from apollo configuration center.
+// It panics when failed, use WithRateLimiterE to handle the error.
+func WithRateLimiter(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) []client.Option {
+	options, err := WithRateLimiterE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithRateLimiterE limits the outbound QPS per method by the config from apollo configuration center.
+func WithRateLimiterE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
+	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.ClientLimitConfigName,
+		ServerServiceName: dest,
+		ClientServiceName: src,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+
+	uniqueID := apollo.GetUniqueID()
+
+	limiters, err := initRateLimiters(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []client.Option{
+		client.WithMiddleware(limiters.middleware),
+		client.WithCloseCallbacks(func() error {
+			// cancel the configuration listener when client is closed.
+			return apolloClient.DeregisterConfig(param, uniqueID)
+		}),
+	}, nil
+}
+
+// rateLimiters the token buckets of the methods, the configs are swapped as a whole
+// and the bucket of a method is kept across the config changes.
+type rateLimiters struct {
+	configs atomic.Value // map[string]*RateLimitConfig
+
+	mu      sync.Mutex
+	buckets sync.Map // method -> *utils.TokenBucket
+}
+
+func (l *rateLimiters) config(method string) *RateLimitConfig {
+	configs := l.configs.Load().(map[string]*RateLimitConfig)
+	if c, ok := configs[method]; ok {
+		return c
+	}
+	return configs[wildcardMethod]
+}
+
+func (l *rateLimiters) bucket(method string) *utils.TokenBucket {
+	if b, ok := l.buckets.Load(method); ok {
+		return b.(*utils.TokenBucket)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets.Load(method); ok {
+		return b.(*utils.TokenBucket)
+	}
+	// load the config under the lock so the bucket is not created with a replaced config
+	c := l.config(method)
+	if c == nil {
+		return nil
+	}
+	b := utils.NewTokenBucket(c.QPS, c.Burst)
+	l.buckets.Store(method, b)
+	return b
+}
+
+func (l *rateLimiters) update(configs map[string]*RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.configs.Store(configs)
+	l.buckets.Range(func(key, value interface{}) bool {
+		c := l.config(key.(string))
+		if c == nil {
+			l.buckets.Delete(key)
+			return true
+		}
+		value.(*utils.TokenBucket).SetLimit(c.QPS, c.Burst)
+		return true
+	})
+}
+
+func (l *rateLimiters) middleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, req, resp interface{}) error {
+		ri := rpcinfo.GetRPCInfo(ctx)
+		if ri == nil {
+			return next(ctx, req, resp)
+		}
+		method := ri.To().Method()
+		c := l.config(method)
+		if c == nil || c.QPS <= 0 {
+			return next(ctx, req, resp)
+		}
+		b := l.bucket(method)
+		if b == nil {
+			return next(ctx, req, resp)
+		}
+		if c.Mode != RateLimitModeWait {
+			if !b.Allow() {
+				return kerrors.ErrQPSOverLimit
+			}
+			return next(ctx, req, resp)
+		}
+		maxWait := time.Duration(c.MaxWaitMS) * time.Millisecond
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < maxWait {
+			maxWait = time.Until(deadline)
+		}
+		wait, ok := b.Reserve(maxWait)
+		if !ok {
+			return kerrors.ErrQPSOverLimit
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+		return next(ctx, req, resp)
+	}
+}
+
+func initRateLimiters(param apollo.ConfigParam, dest string,
+	apolloClient apollo.Client, uniqueID int64,
+) (*rateLimiters, error) {
+	limiters := &rateLimiters{}
+	limiters.configs.Store(map[string]*RateLimitConfig{})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		configs := map[string]*RateLimitConfig{}
+		err := parser.Decode(param.Type, data, &configs)
+		if err != nil {
+			klog.Warnf("[apollo] %s client apollo rate limiter: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		for method, c := range configs {
+			if c == nil {
+				delete(configs, method)
+				continue
+			}
+			if err := c.Validate(); err != nil {
+				klog.Warnf("[apollo] %s client rate limit for method %s is invalid: %s, skip...", dest, method, err)
+				apolloClient.MetricsHook().ValidationRejected(apollo.ClientLimitConfigName)
+				delete(configs, method)
+			}
+		}
+		limiters.update(configs)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+
+	return limiters, nil
+}
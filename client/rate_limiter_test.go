@@ -0,0 +1,97 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+)
+
+func newRateLimitEndpoint(t *testing.T, cli *apollotest.Client) endpoint.Endpoint {
+	limiters, err := initRateLimiters(apollo.ConfigParam{Key: apollo.ClientLimitConfigName, Type: apollo.JSON},
+		"svc", cli, apollo.GetUniqueID())
+	assert.Equal(t, err, nil)
+	return limiters.middleware(func(ctx context.Context, req, resp interface{}) error { return nil })
+}
+
+func callLimited(ep endpoint.Endpoint, method string) error {
+	return ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), newTestRPCInfo(method, nil)), nil, nil)
+}
+
+func TestRateLimiterReject(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.ClientLimitConfigName, `{"*": {"qps": 1, "burst": 2}}`)
+	ep := newRateLimitEndpoint(t, cli)
+
+	// each method has its own bucket
+	for _, method := range []string{"Echo", "Other"} {
+		assert.Equal(t, callLimited(ep, method), nil)
+		assert.Equal(t, callLimited(ep, method), nil)
+		assert.Equal(t, errors.Is(callLimited(ep, method), kerrors.ErrQPSOverLimit), true)
+	}
+
+	// no limit without config
+	cli.Change(apollo.ClientLimitConfigName, `{}`)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, callLimited(ep, "Echo"), nil)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.ClientLimitConfigName, `{"Echo": {"qps": 20, "burst": 1, "mode": "wait", "max_wait_ms": 200}}`)
+	ep := newRateLimitEndpoint(t, cli)
+
+	assert.Equal(t, callLimited(ep, "Echo"), nil)
+	start := time.Now()
+	assert.Equal(t, callLimited(ep, "Echo"), nil)
+	assert.Equal(t, time.Since(start) >= 30*time.Millisecond, true)
+
+	// the wait is bounded by the deadline of the call
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := ep(rpcinfo.NewCtxWithRPCInfo(ctx, newTestRPCInfo("Echo", nil)), nil, nil)
+	assert.Equal(t, errors.Is(err, kerrors.ErrQPSOverLimit), true)
+}
+
+func TestRateLimiterKeepTokensOnUpdate(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.ClientLimitConfigName, `{"Echo": {"qps": 0.01, "burst": 2}}`)
+	ep := newRateLimitEndpoint(t, cli)
+
+	assert.Equal(t, callLimited(ep, "Echo"), nil)
+	assert.Equal(t, callLimited(ep, "Echo"), nil)
+	assert.Equal(t, errors.Is(callLimited(ep, "Echo"), kerrors.ErrQPSOverLimit), true)
+
+	// the drained bucket is not refilled by a larger burst
+	cli.Change(apollo.ClientLimitConfigName, `{"Echo": {"qps": 0.01, "burst": 10}}`)
+	assert.Equal(t, errors.Is(callLimited(ep, "Echo"), kerrors.ErrQPSOverLimit), true)
+
+	// the invalid configs are dropped
+	cli.Change(apollo.ClientLimitConfigName, `{"Echo": {"qps": 100, "mode": "unknown"}}`)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, callLimited(ep, "Echo"), nil)
+	}
+}
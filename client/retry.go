@@ -15,23 +15,102 @@
 package client
 
 import (
+	"sync"
+
 	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/circuitbreak"
 	"github.com/cloudwego/kitex/pkg/klog"
 	"github.com/cloudwego/kitex/pkg/retry"
 	"github.com/kitex-contrib/config-apollo/apollo"
 	"github.com/kitex-contrib/config-apollo/utils"
 )
 
+// RetryContainerKey the reserved key in the retry document for RetryContainerConfig.
+const RetryContainerKey = "__container__"
+
+// RetryContainerConfig the container level retry config.
+type RetryContainerConfig struct {
+	// EnablePercentageLimit limits the percentage of retry requests, true by default.
+	EnablePercentageLimit *bool `json:"enable_percentage_limit"`
+	// ShareCBSuite shares the retry circuit breaker with the service circuit breaker of ApolloClientSuite,
+	// takes effect only when the percentage limit is disabled.
+	ShareCBSuite bool `json:"share_cb_suite"`
+	// ResultRetry the name of the ShouldResultRetry registered by RegisterResultRetry,
+	// used by the failure policies of all the methods.
+	ResultRetry string `json:"result_retry"`
+	// MethodResultRetry the name of the ShouldResultRetry used by the failure policy of the method.
+	MethodResultRetry map[string]string `json:"method_result_retry"`
+}
+
+func (c *RetryContainerConfig) percentageLimit() bool {
+	return c.EnablePercentageLimit == nil || *c.EnablePercentageLimit
+}
+
+func (c *RetryContainerConfig) resultRetry(method string) string {
+	if name, ok := c.MethodResultRetry[method]; ok {
+		return name
+	}
+	return c.ResultRetry
+}
+
+// retryEntry an entry of the retry document, the one of RetryContainerKey holds the container config
+// and the others hold the policies of the methods.
+type retryEntry struct {
+	retry.Policy
+	RetryContainerConfig
+}
+
+var (
+	resultRetryMutex sync.RWMutex
+	resultRetries    = map[string]*retry.ShouldResultRetry{}
+)
+
+// RegisterResultRetry registers the ShouldResultRetry with name, which could be selected by the
+// result_retry of RetryContainerConfig. It should be called before the clients are created.
+func RegisterResultRetry(name string, rr *retry.ShouldResultRetry) {
+	resultRetryMutex.Lock()
+	defer resultRetryMutex.Unlock()
+	resultRetries[name] = rr
+}
+
+func getResultRetry(name string) (*retry.ShouldResultRetry, bool) {
+	resultRetryMutex.RLock()
+	defer resultRetryMutex.RUnlock()
+	rr, ok := resultRetries[name]
+	return rr, ok
+}
+
+// WithRetryPolicy sets the retry policy from apollo configuration center.
+// It panics when failed, use WithRetryPolicyE to handle the error.
 func WithRetryPolicy(dest, src string, apolloClient apollo.Client,
 	opts utils.Options,
 ) []client.Option {
+	options, err := WithRetryPolicyE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithRetryPolicyE sets the retry policy from apollo configuration center.
+func WithRetryPolicyE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
+	options, _, err := withRetryPolicy(dest, src, apolloClient, opts, nil)
+	return options, err
+}
+
+// withRetryPolicy sets the retry policy, cbSuite is shared with the retry container if it's not nil.
+func withRetryPolicy(dest, src string, apolloClient apollo.Client,
+	opts utils.Options, cbSuite *circuitbreak.CBSuite,
+) ([]client.Option, *retryContainer, error) {
 	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
 		Category:          apollo.RetryConfigName,
 		ServerServiceName: dest,
 		ClientServiceName: src,
 	})
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
 	for _, f := range opts.ApolloCustomFunctions {
@@ -40,9 +119,13 @@ func WithRetryPolicy(dest, src string, apolloClient apollo.Client,
 
 	uniqueID := apollo.GetUniqueID()
 
-	rc := initRetryContainer(param, dest, apolloClient, uniqueID)
+	rc, err := initRetryContainer(param, dest, apolloClient, uniqueID, cbSuite)
+	if err != nil {
+		return nil, nil, err
+	}
 	return []client.Option{
-		client.WithRetryContainer(rc),
+		client.WithRetryContainer(rc.Container),
+		client.WithMiddleware(rc.middleware),
 		client.WithCloseCallbacks(func() error {
 			// cancel the configuration listener when client is closed.
 			err := apolloClient.DeregisterConfig(param, uniqueID)
@@ -51,47 +134,77 @@ func WithRetryPolicy(dest, src string, apolloClient apollo.Client,
 			}
 			return rc.Close()
 		}),
-	}
+	}, rc, nil
 }
 
 func initRetryContainer(param apollo.ConfigParam, dest string,
-	apolloClient apollo.Client, uniqueID int64,
-) *retry.Container {
-	retryContainer := retry.NewRetryContainerWithPercentageLimit()
+	apolloClient apollo.Client, uniqueID int64, cbSuite *circuitbreak.CBSuite,
+) (*retryContainer, error) {
+	rc := newRetryContainer(cbSuite)
 
 	ts := utils.ThreadSafeSet{}
 
-	onChangeCallback := func(data string, parser apollo.ConfigParser) {
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
 		// the key is method name, wildcard "*" can match anything.
-		rcs := map[string]*retry.Policy{}
-		err := parser.Decode(param.Type, data, &rcs)
+		entries := map[string]*retryEntry{}
+		err := parser.Decode(param.Type, data, &entries)
 		if err != nil {
 			klog.Warnf("[apollo] %s client apollo retry: unmarshal data %s failed: %s, skip...", dest, data, err)
-			return
+			return err
+		}
+		cc := &RetryContainerConfig{}
+		if e := entries[RetryContainerKey]; e != nil {
+			cc = &e.RetryContainerConfig
 		}
+		rc.update(dest, cc)
 
 		set := utils.Set{}
-		for method, policy := range rcs {
+		for method, e := range entries {
+			if method == RetryContainerKey {
+				continue
+			}
+			if e == nil {
+				delete(entries, method)
+				continue
+			}
+			policy := &e.Policy
 			set[method] = true
 			if policy.BackupPolicy != nil && policy.FailurePolicy != nil {
 				klog.Warnf("[apollo] %s client policy for method %s BackupPolicy and FailurePolicy must not be set at same time",
 					dest, method)
+				apolloClient.MetricsHook().ValidationRejected(apollo.RetryConfigName)
+				delete(entries, method)
 				continue
 			}
 			if policy.BackupPolicy == nil && policy.FailurePolicy == nil {
 				klog.Warnf("[apollo] %s client policy for method %s BackupPolicy and FailurePolicy must not be empty at same time",
 					dest, method)
+				apolloClient.MetricsHook().ValidationRejected(apollo.RetryConfigName)
+				delete(entries, method)
 				continue
 			}
-			retryContainer.NotifyPolicyChange(method, *policy)
+			if name := cc.resultRetry(method); name != "" && policy.FailurePolicy != nil {
+				rr, ok := getResultRetry(name)
+				if !ok {
+					klog.Warnf("[apollo] %s client policy for method %s result retry %s is not registered",
+						dest, method, name)
+					apolloClient.MetricsHook().ValidationRejected(apollo.RetryConfigName)
+				}
+				// the retryer falls back to the one specified by code when it's nil
+				policy.FailurePolicy.ShouldResultRetry = rr
+			}
+			rc.NotifyPolicyChange(method, *policy)
 		}
 
 		for _, method := range ts.DiffAndEmplace(set) {
-			retryContainer.DeletePolicy(method)
+			rc.DeletePolicy(method)
 		}
+		return nil
 	}
 
-	apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID)
-
-	return retryContainer
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return rc, nil
 }
@@ -0,0 +1,211 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/bytedance/gopkg/cloud/circuitbreaker"
+	"github.com/cloudwego/kitex/pkg/circuitbreak"
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/retry"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+)
+
+// the circuit breaker used by the retry container
+const (
+	// retryBreakerPercentage counts the retries against all the calls to limit their percentage.
+	retryBreakerPercentage int32 = iota
+	// retryBreakerShared uses the service circuit breaker of ApolloClientSuite, which records the calls itself.
+	retryBreakerShared
+	// retryBreakerStat records the result of every call to its own circuit breaker.
+	retryBreakerStat
+)
+
+// retryContainer the retry container of a client. Kitex does not support changing the container level
+// options of a built container, so the container is built once with a circuit breaker that delegates to
+// the one selected by the current RetryContainerConfig, which makes enable_percentage_limit and
+// share_cb_suite take effect at runtime.
+type retryContainer struct {
+	*retry.Container
+
+	mode int32
+	// the circuit breakers indexed by mode, the shared one is absent if there is no suite to share.
+	breakers   [3]retryBreaker
+	percentage *circuitbreak.CBSuite
+	stat       *circuitbreak.CBSuite
+}
+
+type retryBreaker struct {
+	ctl   *circuitbreak.Control
+	panel circuitbreaker.Panel
+}
+
+// newRetryBreaker initializes the service circuit breaker of the suite, which is lazily initialized
+// by the suite without locking.
+func newRetryBreaker(cb *circuitbreak.CBSuite) retryBreaker {
+	if cb == nil {
+		return retryBreaker{}
+	}
+	return retryBreaker{ctl: cb.ServiceControl(), panel: cb.ServicePanel()}
+}
+
+func newRetryContainer(shared *circuitbreak.CBSuite) *retryContainer {
+	rc := &retryContainer{
+		percentage: circuitbreak.NewCBSuite(circuitbreak.RPCInfo2Key),
+		stat:       circuitbreak.NewCBSuite(circuitbreak.RPCInfo2Key),
+	}
+	rc.breakers[retryBreakerPercentage] = newRetryBreaker(rc.percentage)
+	rc.breakers[retryBreakerShared] = newRetryBreaker(shared)
+	rc.breakers[retryBreakerStat] = newRetryBreaker(rc.stat)
+	// the retryers record the result of every call, which is dropped by the panel unless it's retryBreakerStat,
+	// and the percentage of the retries is recorded by the middleware.
+	rc.Container = retry.NewRetryContainer(
+		retry.WithContainerCBControl(rc.control()),
+		retry.WithContainerCBPanel((*retryPanel)(rc)),
+		retry.WithContainerCBStat(),
+	)
+	return rc
+}
+
+// update selects the circuit breaker by the container config.
+func (rc *retryContainer) update(dest string, cfg *RetryContainerConfig) {
+	mode := retryBreakerStat
+	switch {
+	case cfg.percentageLimit():
+		if cfg.ShareCBSuite {
+			klog.Warnf("[apollo] %s client apollo retry: share_cb_suite is ignored when enable_percentage_limit is on, "+
+				"as the percentage limit records the retries as failures", dest)
+		}
+		mode = retryBreakerPercentage
+	case cfg.ShareCBSuite:
+		if rc.breakers[retryBreakerShared].panel != nil {
+			mode = retryBreakerShared
+		} else {
+			klog.Warnf("[apollo] %s client apollo retry: no circuit breaker suite to share, skip...", dest)
+		}
+	}
+	atomic.StoreInt32(&rc.mode, mode)
+}
+
+func (rc *retryContainer) current() (retryBreaker, int32) {
+	mode := atomic.LoadInt32(&rc.mode)
+	return rc.breakers[mode], mode
+}
+
+func (rc *retryContainer) control() *circuitbreak.Control {
+	return &circuitbreak.Control{
+		GetKey: func(ctx context.Context, request interface{}) (string, bool) {
+			b, _ := rc.current()
+			return b.ctl.GetKey(ctx, request)
+		},
+		GetErrorType: func(ctx context.Context, request, response interface{}, err error) circuitbreak.ErrorType {
+			b, _ := rc.current()
+			return b.ctl.GetErrorType(ctx, request, response, err)
+		},
+		DecorateError: func(ctx context.Context, request interface{}, err error) error {
+			b, _ := rc.current()
+			return b.ctl.DecorateError(ctx, request, err)
+		},
+	}
+}
+
+// middleware records every call with the percentage limit, the retries as failures and the first
+// calls as successes, the same as the percentage limit of kitex.
+func (rc *retryContainer) middleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, req, resp interface{}) error {
+		if atomic.LoadInt32(&rc.mode) == retryBreakerPercentage && rpcinfo.GetRPCInfo(ctx) != nil {
+			b := rc.breakers[retryBreakerPercentage]
+			if key, enabled := b.ctl.GetKey(ctx, req); enabled {
+				if retry.IsLocalRetryRequest(ctx) {
+					b.panel.Fail(key)
+				} else {
+					b.panel.Succeed(key)
+				}
+			}
+		}
+		return next(ctx, req, resp)
+	}
+}
+
+// Close closes the container and its own circuit breakers, the shared one is closed by its owner.
+func (rc *retryContainer) Close() error {
+	rc.Container.Close()
+	rc.percentage.Close()
+	return rc.stat.Close()
+}
+
+// retryPanel the panel of the retry container which delegates to the selected circuit breaker.
+type retryPanel retryContainer
+
+func (p *retryPanel) panel() (circuitbreaker.Panel, bool) {
+	b, mode := (*retryContainer)(p).current()
+	return b.panel, mode == retryBreakerStat
+}
+
+func (p *retryPanel) Succeed(key string) {
+	if panel, record := p.panel(); record {
+		panel.Succeed(key)
+	}
+}
+
+func (p *retryPanel) Fail(key string) {
+	if panel, record := p.panel(); record {
+		panel.Fail(key)
+	}
+}
+
+func (p *retryPanel) FailWithTrip(key string, f circuitbreaker.TripFunc) {
+	if panel, record := p.panel(); record {
+		panel.FailWithTrip(key, f)
+	}
+}
+
+func (p *retryPanel) Timeout(key string) {
+	if panel, record := p.panel(); record {
+		panel.Timeout(key)
+	}
+}
+
+func (p *retryPanel) TimeoutWithTrip(key string, f circuitbreaker.TripFunc) {
+	if panel, record := p.panel(); record {
+		panel.TimeoutWithTrip(key, f)
+	}
+}
+
+func (p *retryPanel) IsAllowed(key string) bool {
+	panel, _ := p.panel()
+	return panel.IsAllowed(key)
+}
+
+func (p *retryPanel) RemoveBreaker(key string) {
+	panel, _ := p.panel()
+	panel.RemoveBreaker(key)
+}
+
+func (p *retryPanel) DumpBreakers() map[string]circuitbreaker.Breaker {
+	panel, _ := p.panel()
+	return panel.DumpBreakers()
+}
+
+func (p *retryPanel) GetMetricer(key string) circuitbreaker.Metricer {
+	panel, _ := p.panel()
+	return panel.GetMetricer(key)
+}
+
+// Close is a no-op, the circuit breakers are closed by retryContainer.Close.
+func (p *retryPanel) Close() {}
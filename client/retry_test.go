@@ -0,0 +1,112 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/circuitbreak"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+const failureRetryPolicy = `{"enable": true, "type": 0, "failure_policy": {"stop_policy": {"max_retry_times": 2}}}`
+
+func newTestRPCInfo(method string, tags map[string]string) rpcinfo.RPCInfo {
+	return rpcinfo.NewRPCInfo(
+		rpcinfo.NewEndpointInfo("cli", "", nil, nil),
+		rpcinfo.NewEndpointInfo("svc", method, nil, tags),
+		rpcinfo.NewInvocation("svc", method),
+		rpcinfo.NewRPCConfig(),
+		rpcinfo.NewRPCStats(),
+	)
+}
+
+func TestRetryContainerKeyStripped(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.RetryConfigName, `{"__container__": {"enable_percentage_limit": false}, "Echo": `+failureRetryPolicy+`}`)
+	_, rc, err := withRetryPolicy("svc", "cli", cli, utils.Options{}, nil)
+	assert.Equal(t, err, nil)
+	defer rc.Close()
+
+	dump := rc.Dump().(map[string]interface{})
+	_, ok := dump["Echo"]
+	assert.Equal(t, ok, true)
+	_, ok = dump[RetryContainerKey]
+	assert.Equal(t, ok, false)
+}
+
+func TestRetryContainerConfigAtRuntime(t *testing.T) {
+	cli := apollotest.NewClient()
+	shared := circuitbreak.NewCBSuite(circuitbreak.RPCInfo2Key)
+	defer shared.Close()
+	_, rc, err := withRetryPolicy("svc", "cli", cli, utils.Options{}, shared)
+	assert.Equal(t, err, nil)
+	defer rc.Close()
+	panel := (*retryPanel)(rc)
+
+	// the percentage limit is on by default
+	assert.Equal(t, rc.mode, retryBreakerPercentage)
+
+	cli.Change(apollo.RetryConfigName, `{"__container__": {"enable_percentage_limit": false}}`)
+	assert.Equal(t, rc.mode, retryBreakerStat)
+	panel.Fail("k")
+	assert.Equal(t, rc.stat.ServicePanel().GetMetricer("k").Failures(), int64(1))
+
+	cli.Change(apollo.RetryConfigName, `{"__container__": {"enable_percentage_limit": false, "share_cb_suite": true}}`)
+	assert.Equal(t, rc.mode, retryBreakerShared)
+	// the shared circuit breaker records the calls itself
+	panel.Fail("k")
+	assert.Equal(t, shared.ServicePanel().GetMetricer("k").Samples(), int64(0))
+	assert.Equal(t, rc.stat.ServicePanel().GetMetricer("k").Failures(), int64(1))
+	shared.ServicePanel().Fail("k")
+	assert.Equal(t, panel.GetMetricer("k").Failures(), int64(1))
+
+	// share_cb_suite is ignored with the percentage limit
+	cli.Change(apollo.RetryConfigName, `{"__container__": {"share_cb_suite": true}}`)
+	assert.Equal(t, rc.mode, retryBreakerPercentage)
+}
+
+func TestRetryContainerPercentageLimit(t *testing.T) {
+	rc := newRetryContainer(nil)
+	defer rc.Close()
+	rc.update("svc", &RetryContainerConfig{})
+
+	next := func(ctx context.Context, req, resp interface{}) error { return nil }
+	first := newTestRPCInfo("Echo", nil)
+	retried := newTestRPCInfo("Echo", map[string]string{rpcinfo.RetryTag: "1"})
+	ep := rc.middleware(next)
+	for i := 0; i < 3; i++ {
+		ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), first), nil, nil)
+	}
+	ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), retried), nil, nil)
+
+	// the retries are counted as failures against all the calls
+	key := circuitbreak.RPCInfo2Key(first)
+	m := (*retryPanel)(rc).GetMetricer(key)
+	assert.Equal(t, m.Successes(), int64(3))
+	assert.Equal(t, m.Failures(), int64(1))
+
+	// nothing is recorded without the percentage limit
+	disabled := false
+	rc.update("svc", &RetryContainerConfig{EnablePercentageLimit: &disabled})
+	ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), retried), nil, nil)
+	assert.Equal(t, rc.percentage.ServicePanel().GetMetricer(key).Failures(), int64(1))
+}
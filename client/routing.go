@@ -0,0 +1,423 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/loadbalance"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// RouteMatch matches a call when all of its non-empty fields match.
+type RouteMatch struct {
+	// Methods the methods called.
+	Methods []string `json:"methods"`
+	// Callers the service names of the caller, which is the client itself.
+	Callers []string `json:"callers"`
+	// Metainfo the metainfo values of the call, transient or persistent.
+	Metainfo map[string]string `json:"metainfo"`
+}
+
+// Route the instances with all the tags, which receive the percentage of the matched calls.
+type Route struct {
+	Tags map[string]string `json:"tags"`
+	// Percentage the percentage of the matched calls in [0, 100].
+	Percentage float64 `json:"percentage"`
+}
+
+// RoutingRule routes the matched calls to the routes, the calls not covered by the percentages of the
+// routes go to the instances not matching any of the routes.
+type RoutingRule struct {
+	// Name the name of the rule, for reading only.
+	Name   string      `json:"name"`
+	Match  *RouteMatch `json:"match"`
+	Routes []*Route    `json:"routes"`
+	// Strict fails the call when the selected route has no instance, instead of using all the instances.
+	Strict bool `json:"strict"`
+}
+
+// RoutingConfig the routing rules of the downstream, evaluated in order and the first matched one applies.
+type RoutingConfig struct {
+	Rules []*RoutingRule `json:"rules"`
+}
+
+// Validate checks the config.
+func (c *RoutingConfig) Validate() error {
+	for i, r := range c.Rules {
+		if r == nil {
+			return fmt.Errorf("rule %d is empty", i)
+		}
+		var sum float64
+		for _, route := range r.Routes {
+			if route == nil || len(route.Tags) == 0 {
+				return fmt.Errorf("route of rule %d has no tags", i)
+			}
+			if route.Percentage < 0 || route.Percentage > 100 {
+				return fmt.Errorf("percentage %v of rule %d is out of [0, 100]", route.Percentage, i)
+			}
+			sum += route.Percentage
+		}
+		if sum > 100 {
+			return fmt.Errorf("percentages of rule %d sum to %v, over 100", i, sum)
+		}
+	}
+	return nil
+}
+
+// route the compiled Route, key identifies the instances of the tags.
+type route struct {
+	tags map[string]string
+	key  string
+	// upper the cumulative percentage of the routes up to this one
+	upper float64
+	// excludes the routes whose instances are excluded, set for the rest of a rule only
+	excludes []*route
+}
+
+func (r *route) match(ins discovery.Instance) bool {
+	for _, ex := range r.excludes {
+		if ex.match(ins) {
+			return false
+		}
+	}
+	for k, v := range r.tags {
+		if value, ok := ins.Tag(k); !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// routingRule the compiled RoutingRule.
+type routingRule struct {
+	methods  utils.Set
+	callers  utils.Set
+	metainfo map[string]string
+	routes   []*route
+	// rest the instances not matching any of the routes
+	rest   *route
+	strict bool
+}
+
+func newRoutingRule(r *RoutingRule) *routingRule {
+	rule := &routingRule{strict: r.Strict}
+	if m := r.Match; m != nil {
+		rule.methods = toSet(m.Methods)
+		rule.callers = toSet(m.Callers)
+		rule.metainfo = m.Metainfo
+	}
+	var upper float64
+	keys := make([]string, 0, len(r.Routes))
+	for _, rt := range r.Routes {
+		upper += rt.Percentage
+		rule.routes = append(rule.routes, &route{tags: rt.Tags, key: tagsKey(rt.Tags), upper: upper})
+		keys = append(keys, tagsKey(rt.Tags))
+	}
+	if len(rule.routes) > 0 {
+		sort.Strings(keys)
+		rule.rest = &route{key: "!" + strings.Join(keys, ";"), excludes: rule.routes}
+	}
+	return rule
+}
+
+func toSet(values []string) utils.Set {
+	if len(values) == 0 {
+		return nil
+	}
+	s := utils.Set{}
+	for _, v := range values {
+		s[v] = true
+	}
+	return s
+}
+
+// tagsKey renders the tags in order.
+func tagsKey(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (r *routingRule) match(ctx context.Context, ri rpcinfo.RPCInfo) bool {
+	if r.methods != nil && !r.methods[ri.To().Method()] {
+		return false
+	}
+	if r.callers != nil {
+		from := ri.From()
+		if from == nil || !r.callers[from.ServiceName()] {
+			return false
+		}
+	}
+	for k, v := range r.metainfo {
+		if value, ok := metainfoValue(ctx, k); !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// pick selects the route by the percentages, nil for all the instances.
+func (r *routingRule) pick() *route {
+	if len(r.routes) == 0 {
+		return nil
+	}
+	p := rand.Float64() * 100
+	for _, rt := range r.routes {
+		if p < rt.upper {
+			return rt
+		}
+	}
+	return r.rest
+}
+
+// WithRouting routes the calls to the instances of the tags by the config from apollo configuration
+// center, the instances are picked by the weighted round robin balancer.
+// It panics when failed, use WithRoutingE to handle the error.
+func WithRouting(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) []client.Option {
+	options, err := WithRoutingE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithRoutingE routes the calls to the instances of the tags by the config from apollo configuration
+// center, the instances are picked by the weighted round robin balancer.
+func WithRoutingE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
+	return withRouting(dest, src, apolloClient, opts, loadbalance.NewWeightedRoundRobinBalancer())
+}
+
+// withRouting routes the calls and picks the instances by the balancer.
+func withRouting(dest, src string, apolloClient apollo.Client,
+	opts utils.Options, balancer loadbalance.Loadbalancer,
+) ([]client.Option, error) {
+	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.RoutingConfigName,
+		ServerServiceName: dest,
+		ClientServiceName: src,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+
+	uniqueID := apollo.GetUniqueID()
+
+	lb, err := initRouting(param, dest, apolloClient, uniqueID, balancer)
+	if err != nil {
+		return nil, err
+	}
+
+	return []client.Option{
+		client.WithLoadBalancer(lb),
+		client.WithCloseCallbacks(func() error {
+			// cancel the configuration listener when client is closed.
+			return apolloClient.DeregisterConfig(param, uniqueID)
+		}),
+	}, nil
+}
+
+// routingLoadBalancer filters the instances by the routing rules and picks one by the inner balancer.
+// The filtered results are cached by the cache key of the result and the tags of the route.
+type routingLoadBalancer struct {
+	name  string
+	inner loadbalance.Loadbalancer
+	rules atomic.Value // []*routingRule
+
+	mu      sync.Mutex
+	subsets sync.Map // cache key -> *sync.Map (route key -> discovery.Result)
+}
+
+var (
+	_ loadbalance.Loadbalancer = &routingLoadBalancer{}
+	_ loadbalance.Rebalancer   = &routingLoadBalancer{}
+)
+
+// GetPicker implements loadbalance.Loadbalancer.
+func (lb *routingLoadBalancer) GetPicker(res discovery.Result) loadbalance.Picker {
+	rules := lb.rules.Load().([]*routingRule)
+	if len(rules) == 0 {
+		return lb.inner.GetPicker(res)
+	}
+	return &routingPicker{lb: lb, rules: rules, res: res}
+}
+
+// subset returns the instances of the route.
+func (lb *routingLoadBalancer) subset(res discovery.Result, rt *route) discovery.Result {
+	if !res.Cacheable {
+		return filterResult(res, rt)
+	}
+	v, ok := lb.subsets.Load(res.CacheKey)
+	if !ok {
+		lb.mu.Lock()
+		v, ok = lb.subsets.Load(res.CacheKey)
+		if !ok {
+			v = &sync.Map{}
+			lb.subsets.Store(res.CacheKey, v)
+		}
+		lb.mu.Unlock()
+	}
+	pools := v.(*sync.Map)
+	if sub, ok := pools.Load(rt.key); ok {
+		return sub.(discovery.Result)
+	}
+	sub := filterResult(res, rt)
+	pools.Store(rt.key, sub)
+	return sub
+}
+
+func filterResult(res discovery.Result, rt *route) discovery.Result {
+	sub := discovery.Result{Cacheable: res.Cacheable, CacheKey: res.CacheKey + "|route:" + rt.key}
+	for _, ins := range res.Instances {
+		if rt.match(ins) {
+			sub.Instances = append(sub.Instances, ins)
+		}
+	}
+	return sub
+}
+
+// Rebalance implements loadbalance.Rebalancer, the filtered results of the cache key are dropped.
+func (lb *routingLoadBalancer) Rebalance(change discovery.Change) {
+	if !change.Result.Cacheable {
+		return
+	}
+	lb.dropSubsets(change.Result.CacheKey)
+	if rb, ok := lb.inner.(loadbalance.Rebalancer); ok {
+		rb.Rebalance(change)
+	}
+}
+
+// Delete implements loadbalance.Rebalancer.
+func (lb *routingLoadBalancer) Delete(change discovery.Change) {
+	if !change.Result.Cacheable {
+		return
+	}
+	lb.dropSubsets(change.Result.CacheKey)
+	if rb, ok := lb.inner.(loadbalance.Rebalancer); ok {
+		rb.Delete(change)
+	}
+}
+
+func (lb *routingLoadBalancer) dropSubsets(cacheKey string) {
+	lb.mu.Lock()
+	v, ok := lb.subsets.LoadAndDelete(cacheKey)
+	lb.mu.Unlock()
+	if !ok {
+		return
+	}
+	rb, isRebalancer := lb.inner.(loadbalance.Rebalancer)
+	v.(*sync.Map).Range(func(key, value interface{}) bool {
+		if isRebalancer {
+			rb.Delete(discovery.Change{Result: value.(discovery.Result)})
+		}
+		return true
+	})
+}
+
+// Name implements loadbalance.Loadbalancer. It contains the uniqueID of the config listener, as kitex
+// caches the balancer factories by name and the clients of the same destination must not share one.
+func (lb *routingLoadBalancer) Name() string {
+	return lb.name
+}
+
+// routingPicker evaluates the routing rules for each call.
+type routingPicker struct {
+	lb    *routingLoadBalancer
+	rules []*routingRule
+	res   discovery.Result
+}
+
+// Next implements loadbalance.Picker.
+func (p *routingPicker) Next(ctx context.Context, request interface{}) discovery.Instance {
+	ri := rpcinfo.GetRPCInfo(ctx)
+	if ri == nil {
+		return p.lb.inner.GetPicker(p.res).Next(ctx, request)
+	}
+	for _, r := range p.rules {
+		if !r.match(ctx, ri) {
+			continue
+		}
+		rt := r.pick()
+		if rt == nil {
+			break
+		}
+		sub := p.lb.subset(p.res, rt)
+		if len(sub.Instances) > 0 {
+			return p.lb.inner.GetPicker(sub).Next(ctx, request)
+		}
+		if r.strict {
+			return nil
+		}
+		break
+	}
+	return p.lb.inner.GetPicker(p.res).Next(ctx, request)
+}
+
+func initRouting(param apollo.ConfigParam, dest string, apolloClient apollo.Client, uniqueID int64,
+	inner loadbalance.Loadbalancer,
+) (*routingLoadBalancer, error) {
+	lb := &routingLoadBalancer{
+		name:  fmt.Sprintf("apollo_routing:%s/%s#%d|%s", param.Cluster, param.Key, uniqueID, inner.Name()),
+		inner: inner,
+	}
+	lb.rules.Store([]*routingRule{})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		cfg := &RoutingConfig{}
+		err := parser.Decode(param.Type, data, cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s client apollo routing: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			klog.Warnf("[apollo] %s client routing config is invalid: %s, skip...", dest, err)
+			return err
+		}
+		rules := make([]*routingRule, 0, len(cfg.Rules))
+		for _, r := range cfg.Rules {
+			rules = append(rules, newRoutingRule(r))
+		}
+		lb.rules.Store(rules)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+
+	return lb, nil
+}
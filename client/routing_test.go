@@ -0,0 +1,102 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/loadbalance"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+)
+
+func newTestRouting(t *testing.T, cli *apollotest.Client) *routingLoadBalancer {
+	param, err := cli.ClientConfigParam(&apollo.ConfigParamConfig{Category: apollo.RoutingConfigName})
+	assert.Equal(t, err, nil)
+	lb, err := initRouting(param, "svc", cli, apollo.GetUniqueID(), loadbalance.NewWeightedRandomBalancer())
+	assert.Equal(t, err, nil)
+	return lb
+}
+
+// countPicks picks n times for the method and counts the picked addresses, "" for no instance.
+func countPicks(lb *routingLoadBalancer, method string, n int) map[string]int {
+	// the tag env of the test instances is their address
+	res := newTestResult("127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3")
+	ctx := rpcinfo.NewCtxWithRPCInfo(context.Background(), newTestRPCInfo(method, nil))
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		ins := lb.GetPicker(res).Next(ctx, nil)
+		if ins == nil {
+			counts[""]++
+			continue
+		}
+		counts[ins.Address().String()]++
+	}
+	return counts
+}
+
+func TestRoutingName(t *testing.T) {
+	cli := apollotest.NewClient()
+	assert.NotEqual(t, newTestRouting(t, cli).Name(), newTestRouting(t, cli).Name())
+}
+
+func TestRoutingPercentage(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.RoutingConfigName, `{"rules": [{"match": {"methods": ["echo"]}, "routes": [
+		{"tags": {"env": "127.0.0.1:1"}, "percentage": 20},
+		{"tags": {"env": "127.0.0.1:2"}, "percentage": 50}
+	]}]}`)
+	lb := newTestRouting(t, cli)
+
+	const n = 10000
+	counts := countPicks(lb, "echo", n)
+	within := func(got int, percentage float64) bool {
+		expected := n * percentage / 100
+		return float64(got) > expected-n*0.03 && float64(got) < expected+n*0.03
+	}
+	assert.Equal(t, within(counts["127.0.0.1:1"], 20), true)
+	assert.Equal(t, within(counts["127.0.0.1:2"], 50), true)
+	// the rest goes to the instances not matching any of the routes
+	assert.Equal(t, within(counts["127.0.0.1:3"], 30), true)
+
+	// the calls not matched are not routed
+	counts = countPicks(lb, "other", n)
+	assert.Equal(t, within(counts["127.0.0.1:1"], 100.0/3), true)
+}
+
+func TestRoutingStrict(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.RoutingConfigName, `{"rules": [{"routes": [{"tags": {"env": "absent"}, "percentage": 100}]}]}`)
+	lb := newTestRouting(t, cli)
+
+	// all the instances are used when the route has no instance
+	counts := countPicks(lb, "echo", 300)
+	assert.Equal(t, counts[""], 0)
+	assert.Equal(t, len(counts), 3)
+
+	// the call fails in strict mode
+	cli.Change(apollo.RoutingConfigName, `{"rules": [{"routes": [{"tags": {"env": "absent"}, "percentage": 100}], "strict": true}]}`)
+	counts = countPicks(lb, "echo", 10)
+	assert.Equal(t, counts[""], 10)
+
+	// the invalid config is skipped
+	cli.Change(apollo.RoutingConfigName, `{"rules": [{"routes": [{"tags": {"env": "absent"}, "percentage": 101}]}]}`)
+	counts = countPicks(lb, "echo", 10)
+	assert.Equal(t, counts[""], 10)
+}
@@ -24,16 +24,28 @@ import (
 )
 
 // WithRPCTimeout sets the RPC timeout policy from apollo configuration center.
+// It panics when failed, use WithRPCTimeoutE to handle the error.
 func WithRPCTimeout(dest, src string, apolloClient apollo.Client,
 	opts utils.Options,
 ) []client.Option {
+	options, err := WithRPCTimeoutE(dest, src, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return options
+}
+
+// WithRPCTimeoutE sets the RPC timeout policy from apollo configuration center.
+func WithRPCTimeoutE(dest, src string, apolloClient apollo.Client,
+	opts utils.Options,
+) ([]client.Option, error) {
 	param, err := apolloClient.ClientConfigParam(&apollo.ConfigParamConfig{
 		Category:          apollo.RpcTimeoutConfigName,
 		ServerServiceName: dest,
 		ClientServiceName: src,
 	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	for _, f := range opts.ApolloCustomFunctions {
 		f(&param)
@@ -41,31 +53,39 @@ func WithRPCTimeout(dest, src string, apolloClient apollo.Client,
 
 	uniqueID := apollo.GetUniqueID()
 
+	tp, err := initRPCTimeoutContainer(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return nil, err
+	}
+
 	return []client.Option{
-		client.WithTimeoutProvider(initRPCTimeoutContainer(param, dest, apolloClient, uniqueID)),
+		client.WithTimeoutProvider(tp),
 		client.WithCloseCallbacks(func() error {
 			// cancel the configuration listener when client is closed.
 			return apolloClient.DeregisterConfig(param, uniqueID)
 		}),
-	}
+	}, nil
 }
 
 func initRPCTimeoutContainer(param apollo.ConfigParam, dest string,
 	apolloClient apollo.Client, uniqueID int64,
-) rpcinfo.TimeoutProvider {
+) (rpcinfo.TimeoutProvider, error) {
 	rpcTimeoutContainer := rpctimeout.NewContainer()
 
-	onChangeCallback := func(data string, parser apollo.ConfigParser) {
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
 		configs := map[string]*rpctimeout.RPCTimeout{}
 		err := parser.Decode(param.Type, data, &configs)
 		if err != nil {
 			klog.Warnf("[apollo] %s client apollo rpc timeout: unmarshal data %s failed: %s, skip...", dest, data, err)
-			return
+			return err
 		}
 		rpcTimeoutContainer.NotifyPolicyChange(configs)
+		return nil
 	}
 
-	apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID)
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
 
-	return rpcTimeoutContainer
+	return rpcTimeoutContainer, nil
 }
@@ -16,6 +16,9 @@ package client
 
 import (
 	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/circuitbreak"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/loadbalance"
 	"github.com/kitex-contrib/config-apollo/apollo"
 	"github.com/kitex-contrib/config-apollo/utils"
 )
@@ -25,6 +28,14 @@ type ApolloClientSuite struct {
 	service      string
 	client       string
 	opts         utils.Options
+	// options built by NewSuiteE
+	built []client.Option
+	// the circuit breaker suite shared with the retry container
+	cbSuite *circuitbreak.CBSuite
+	// the retry container, closed with the circuit breaker suite when building the options fails
+	retryContainer *retryContainer
+	// the load balancer wrapped by the routing
+	balancer loadbalance.Loadbalancer
 }
 
 type ClientSuiteOption func(*ApolloClientSuite)
@@ -43,10 +54,109 @@ func NewSuite(service, client string, cli apollo.Client,
 	return client_suite
 }
 
+// NewSuiteE creates the suite and builds its options, returns the error instead of
+// panicking in Options when the config params can not be rendered or registered.
+func NewSuiteE(service, client string, cli apollo.Client,
+	options ...utils.Option,
+) (*ApolloClientSuite, error) {
+	s := NewSuite(service, client, cli, options...)
+	opts, err := s.OptionsE()
+	if err != nil {
+		return nil, err
+	}
+	s.built = opts
+	return s, nil
+}
+
+// Options return a list client.Option, it panics when failed to build the options.
 func (s *ApolloClientSuite) Options() []client.Option {
-	opts := make([]client.Option, 0, 7)
-	opts = append(opts, WithRetryPolicy(s.service, s.client, s.apolloClient, s.opts)...)
-	opts = append(opts, WithRPCTimeout(s.service, s.client, s.apolloClient, s.opts)...)
-	opts = append(opts, WithCircuitBreaker(s.service, s.client, s.apolloClient, s.opts)...)
+	if s.built != nil {
+		return s.built
+	}
+	opts, err := s.OptionsE()
+	if err != nil {
+		panic(err)
+	}
 	return opts
 }
+
+type categoryOptions struct {
+	category string
+	with     func(s *ApolloClientSuite, cli apollo.Client) ([]client.Option, error)
+}
+
+// suiteCategories the governance categories installed by the suite unless disabled, the opt-in ones
+// are installed only when enabled, see utils.EnableCategories.
+// The circuit breaker goes before retry to share its suite with the retry container,
+// and the load balancer goes before routing to be wrapped by it.
+var suiteCategories = []categoryOptions{
+	{apollo.CircuitBreakerConfigName, func(s *ApolloClientSuite, cli apollo.Client) (opts []client.Option, err error) {
+		opts, s.cbSuite, err = withCircuitBreaker(s.service, s.client, cli, s.opts)
+		return opts, err
+	}},
+	{apollo.RetryConfigName, func(s *ApolloClientSuite, cli apollo.Client) (opts []client.Option, err error) {
+		opts, s.retryContainer, err = withRetryPolicy(s.service, s.client, cli, s.opts, s.cbSuite)
+		return opts, err
+	}},
+	{apollo.RpcTimeoutConfigName, func(s *ApolloClientSuite, cli apollo.Client) ([]client.Option, error) {
+		return WithRPCTimeoutE(s.service, s.client, cli, s.opts)
+	}},
+	{apollo.ClientLimitConfigName, func(s *ApolloClientSuite, cli apollo.Client) ([]client.Option, error) {
+		return WithRateLimiterE(s.service, s.client, cli, s.opts)
+	}},
+	{apollo.LoadBalanceConfigName, func(s *ApolloClientSuite, cli apollo.Client) (opts []client.Option, err error) {
+		opts, s.balancer, err = withLoadBalancer(s.service, s.client, cli, s.opts)
+		return opts, err
+	}},
+	{apollo.RoutingConfigName, func(s *ApolloClientSuite, cli apollo.Client) ([]client.Option, error) {
+		balancer := s.balancer
+		if balancer == nil {
+			balancer = loadbalance.NewWeightedRoundRobinBalancer()
+		}
+		return withRouting(s.service, s.client, cli, s.opts, balancer)
+	}},
+	{apollo.MetadataConfigName, func(s *ApolloClientSuite, cli apollo.Client) ([]client.Option, error) {
+		return WithMetadataE(s.service, s.client, cli, s.opts)
+	}},
+	{apollo.PayloadLimitConfigName, func(s *ApolloClientSuite, cli apollo.Client) ([]client.Option, error) {
+		return WithPayloadLimitE(s.service, s.client, cli, s.opts)
+	}},
+}
+
+// OptionsE return a list client.Option or the error when failed to build them.
+// The config listeners and the circuit breaker suites of the categories built before the failed one
+// are released when it fails.
+func (s *ApolloClientSuite) OptionsE() ([]client.Option, error) {
+	tracked := utils.NewTrackedClient(s.apolloClient)
+	s.cbSuite, s.retryContainer, s.balancer = nil, nil, nil
+	opts := make([]client.Option, 0, 17)
+	for _, c := range suiteCategories {
+		if !s.opts.Enabled(c.category) {
+			continue
+		}
+		o, err := c.with(s, tracked)
+		if err != nil {
+			s.release(tracked)
+			return nil, err
+		}
+		opts = append(opts, o...)
+	}
+	return opts, nil
+}
+
+// release deregisters the config listeners and closes the circuit breaker suite and the retry
+// container built by OptionsE, as the options are discarded and their close callbacks never run.
+func (s *ApolloClientSuite) release(tracked *utils.TrackedClient) {
+	if err := tracked.DeregisterAll(); err != nil {
+		klog.Warnf("[apollo] %s client deregister config failed: %s", s.service, err)
+	}
+	if s.retryContainer != nil {
+		s.retryContainer.Close()
+		s.retryContainer = nil
+	}
+	if s.cbSuite != nil {
+		s.cbSuite.Close()
+		s.cbSuite = nil
+	}
+	s.balancer = nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+func TestSuiteOptInCategories(t *testing.T) {
+	cli := apollotest.NewClient()
+	s, err := NewSuiteE("svc", "cli", cli)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cli.Subscribed(apollo.LoadBalanceConfigName), false)
+	assert.Equal(t, cli.Subscribed(apollo.RoutingConfigName), false)
+	assert.Equal(t, cli.Subscribed(apollo.MetadataConfigName), false)
+	assert.Equal(t, s.balancer, nil)
+
+	cli = apollotest.NewClient()
+	s, err = NewSuiteE("svc", "cli", cli, utils.EnableCategories(apollo.LoadBalanceConfigName))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cli.Subscribed(apollo.LoadBalanceConfigName), true)
+	assert.Equal(t, cli.Subscribed(apollo.RoutingConfigName), false)
+	assert.NotEqual(t, s.balancer, nil)
+
+	cli = apollotest.NewClient()
+	_, err = NewSuiteE("svc", "cli", cli, utils.EnableCategories(apollo.RoutingConfigName, apollo.MetadataConfigName))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cli.Subscribed(apollo.RoutingConfigName), true)
+	assert.Equal(t, cli.Subscribed(apollo.MetadataConfigName), true)
+
+	// the later option wins
+	cli = apollotest.NewClient()
+	_, err = NewSuiteE("svc", "cli", cli, utils.EnableCategories(apollo.LoadBalanceConfigName),
+		utils.DisableCategories(apollo.LoadBalanceConfigName))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cli.Subscribed(apollo.LoadBalanceConfigName), false)
+}
+
+func TestSuiteOptionsE(t *testing.T) {
+	cli := apollotest.NewClient()
+	opts, err := NewSuite("svc", "cli", cli).OptionsE()
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, len(opts), 0)
+	assert.NotEqual(t, cli.Subscriptions(), 0)
+}
+
+func TestSuiteOptionsEReleaseOnError(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Failing = apollo.PayloadLimitConfigName
+	s := NewSuite("svc", "cli", cli)
+	opts, err := s.OptionsE()
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, len(opts), 0)
+	// the categories built before payload_limit are released
+	assert.Equal(t, cli.Subscriptions(), 0)
+	assert.Equal(t, s.cbSuite, nil)
+	assert.Equal(t, s.retryContainer, nil)
+	// the apollo client shared with the other suites keeps running
+	assert.Equal(t, cli.Closed(), false)
+
+	_, err = NewSuiteE("svc", "cli", cli)
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, cli.Subscriptions(), 0)
+
+	// nothing is built for the disabled failing category
+	_, err = NewSuiteE("svc", "cli", cli, utils.DisableCategories(apollo.PayloadLimitConfigName))
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, cli.Subscriptions(), 0)
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"net/http"
+
+	"github.com/bytedance/sonic"
+	"github.com/cloudwego/kitex/pkg/klog"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+)
+
+// Response the introspection result of the apollo clients.
+type Response struct {
+	Configs []apollo.ConfigState `json:"configs"`
+}
+
+type handler struct {
+	clients []apollo.Client
+}
+
+// NewHandler returns a http.Handler which dumps the effective governance config
+// of the apollo clients in JSON, which is shared by ApolloClientSuite and ApolloServerSuite.
+func NewHandler(clients ...apollo.Client) http.Handler {
+	return &handler{clients: clients}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	resp := Response{Configs: make([]apollo.ConfigState, 0)}
+	for _, cli := range h.clients {
+		resp.Configs = append(resp.Configs, cli.ConfigStates()...)
+	}
+	data, err := sonic.Marshal(&resp)
+	if err != nil {
+		klog.Warnf("[apollo] debug handler: marshal config states failed: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
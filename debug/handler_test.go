@@ -0,0 +1,112 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+)
+
+type statesClient struct {
+	apollo.Client
+	states []apollo.ConfigState
+}
+
+func (c *statesClient) ConfigStates() []apollo.ConfigState {
+	return c.states
+}
+
+func TestHandler(t *testing.T) {
+	updateTime := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	limit := &statesClient{states: []apollo.ConfigState{{
+		Key:       "svc",
+		Namespace: "limit",
+		Cluster:   "default",
+		Category:  "limit",
+		// the unknown keys are kept in the raw value but not in the effective config
+		RawValue:   `{"qps_limit":100,"unknown":true}`,
+		Effective:  json.RawMessage(`{"connection_limit":0,"qps_limit":100}`),
+		UpdateTime: updateTime,
+		UniqueIDs:  []int64{1},
+	}}}
+	// the config is received but rejected, so nothing is effective
+	retry := &statesClient{states: []apollo.ConfigState{{
+		Key:       "cli.svc",
+		Namespace: "retry",
+		Cluster:   "default",
+		Category:  "retry",
+		RawValue:  `{"*":`,
+		UniqueIDs: []int64{2, 3},
+	}}}
+
+	w := httptest.NewRecorder()
+	NewHandler(limit, retry).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/apollo", nil))
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Header().Get("Content-Type"), "application/json")
+
+	var resp struct {
+		Configs []struct {
+			Key        string                 `json:"key"`
+			Namespace  string                 `json:"namespace"`
+			Cluster    string                 `json:"cluster"`
+			Category   string                 `json:"category"`
+			RawValue   string                 `json:"raw_value"`
+			Effective  map[string]interface{} `json:"effective"`
+			UpdateTime time.Time              `json:"update_time"`
+			UniqueIDs  []int64                `json:"unique_ids"`
+		} `json:"configs"`
+	}
+	assert.Equal(t, json.Unmarshal(w.Body.Bytes(), &resp), nil)
+	assert.Equal(t, len(resp.Configs), 2)
+
+	c := resp.Configs[0]
+	assert.Equal(t, c.Key, "svc")
+	assert.Equal(t, c.Namespace, "limit")
+	assert.Equal(t, c.Cluster, "default")
+	assert.Equal(t, c.Category, "limit")
+	assert.Equal(t, c.RawValue, `{"qps_limit":100,"unknown":true}`)
+	assert.Equal(t, c.Effective, map[string]interface{}{"connection_limit": float64(0), "qps_limit": float64(100)})
+	_, ok := c.Effective["unknown"]
+	assert.Equal(t, ok, false)
+	assert.Equal(t, c.UpdateTime.Equal(updateTime), true)
+	assert.Equal(t, c.UniqueIDs, []int64{1})
+
+	c = resp.Configs[1]
+	assert.Equal(t, c.Key, "cli.svc")
+	assert.Equal(t, c.RawValue, `{"*":`)
+	assert.Equal(t, c.Effective == nil, true)
+	assert.Equal(t, c.UniqueIDs, []int64{2, 3})
+}
+
+func TestHandlerEmpty(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/apollo", nil))
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Body.String(), `{"configs":[]}`)
+}
+
+func TestHandlerMethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler(&statesClient{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/apollo", nil))
+	assert.Equal(t, w.Code, http.StatusMethodNotAllowed)
+	assert.Equal(t, w.Header().Get("Allow"), http.MethodGet)
+}
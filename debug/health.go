@@ -0,0 +1,69 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"net/http"
+
+	"github.com/bytedance/sonic"
+	"github.com/cloudwego/kitex/pkg/klog"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+)
+
+// HealthResponse the health status of the apollo clients.
+type HealthResponse struct {
+	Ready    bool            `json:"ready"`
+	Statuses []apollo.Status `json:"statuses"`
+}
+
+type healthHandler struct {
+	clients []apollo.Client
+}
+
+// NewHealthHandler returns a http.Handler for readiness probes, which responds 200 when all the
+// apollo clients are ready, that is the governance config has been loaded, and 503 otherwise.
+func NewHealthHandler(clients ...apollo.Client) http.Handler {
+	return &healthHandler{clients: clients}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	resp := HealthResponse{
+		Ready:    true,
+		Statuses: make([]apollo.Status, 0, len(h.clients)),
+	}
+	for _, cli := range h.clients {
+		status := cli.Status()
+		resp.Ready = resp.Ready && status.Ready()
+		resp.Statuses = append(resp.Statuses, status)
+	}
+	data, err := sonic.Marshal(&resp)
+	if err != nil {
+		klog.Warnf("[apollo] health handler: marshal status failed: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(data)
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+)
+
+type statusClient struct {
+	apollo.Client
+	status apollo.Status
+}
+
+func (c *statusClient) Status() apollo.Status {
+	return c.status
+}
+
+func TestHealthHandler(t *testing.T) {
+	ready := &statusClient{status: apollo.Status{Running: true}}
+	notReady := &statusClient{status: apollo.Status{
+		Running: true,
+		Keys:    []apollo.KeyStatus{{Key: "k", Loaded: false}},
+	}}
+
+	w := httptest.NewRecorder()
+	NewHealthHandler(ready).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Header().Get("Content-Type"), "application/json")
+
+	w = httptest.NewRecorder()
+	NewHealthHandler(ready, notReady).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+}
+
+func TestHealthHandlerMethodNotAllowed(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		NewHealthHandler(&statusClient{}).ServeHTTP(w, httptest.NewRequest(method, "/ready", nil))
+		assert.Equal(t, w.Code, http.StatusMethodNotAllowed)
+		assert.Equal(t, w.Header().Get("Allow"), http.MethodGet)
+	}
+}
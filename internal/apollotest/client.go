@@ -0,0 +1,170 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apollotest provides the fake apollo client shared by the tests of the suites.
+package apollotest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+)
+
+// JSONParser decodes the config in JSON.
+type JSONParser struct{}
+
+// Decode implements apollo.ConfigParser.
+func (JSONParser) Decode(kind apollo.ConfigType, data string, config interface{}) error {
+	return sonic.Unmarshal([]byte(data), config)
+}
+
+// NoopMetricsHook reports nothing.
+type NoopMetricsHook struct{}
+
+func (NoopMetricsHook) ConfigReceived(string)     {}
+func (NoopMetricsHook) ConfigApplied(string)      {}
+func (NoopMetricsHook) DecodeFailed(string)       {}
+func (NoopMetricsHook) ValidationRejected(string) {}
+func (NoopMetricsHook) LongPollError(string)      {}
+func (NoopMetricsHook) Reconnected(string)        {}
+func (NoopMetricsHook) Synced(string, time.Time)  {}
+func (NoopMetricsHook) ActiveSubscriptions(int)   {}
+
+// Client delivers the config of every category to the callbacks registered for it, the key of the
+// config params is the category. Like the apollo client, the config is delivered when the callback is
+// registered, deregistering the last callback keeps it running, and RegisterConfigCallback returns
+// apollo.ErrClientClosed only after Close.
+type Client struct {
+	apollo.Client
+
+	// Failing the category whose config params fail to render.
+	Failing string
+
+	mu        sync.Mutex
+	closed    bool
+	data      map[string]string
+	callbacks map[string]map[int64]func(string, apollo.ConfigParser) error
+}
+
+// NewClient creates the fake client.
+func NewClient() *Client {
+	return &Client{
+		data:      map[string]string{},
+		callbacks: map[string]map[int64]func(string, apollo.ConfigParser) error{},
+	}
+}
+
+func (c *Client) configParam(cpc *apollo.ConfigParamConfig) (apollo.ConfigParam, error) {
+	if cpc.Category == c.Failing {
+		return apollo.ConfigParam{}, fmt.Errorf("render %s failed", cpc.Category)
+	}
+	return apollo.ConfigParam{Key: cpc.Category, Cluster: "default", Type: apollo.JSON}, nil
+}
+
+// ClientConfigParam implements apollo.Client.
+func (c *Client) ClientConfigParam(cpc *apollo.ConfigParamConfig) (apollo.ConfigParam, error) {
+	return c.configParam(cpc)
+}
+
+// ServerConfigParam implements apollo.Client.
+func (c *Client) ServerConfigParam(cpc *apollo.ConfigParamConfig) (apollo.ConfigParam, error) {
+	return c.configParam(cpc)
+}
+
+// RegisterConfigCallback implements apollo.Client.
+func (c *Client) RegisterConfigCallback(param apollo.ConfigParam,
+	callback func(string, apollo.ConfigParser) error, uniqueID int64,
+) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return apollo.ErrClientClosed
+	}
+	if c.callbacks[param.Key] == nil {
+		c.callbacks[param.Key] = map[int64]func(string, apollo.ConfigParser) error{}
+	}
+	c.callbacks[param.Key][uniqueID] = callback
+	data, ok := c.data[param.Key]
+	c.mu.Unlock()
+	if ok {
+		callback(data, JSONParser{})
+	}
+	return nil
+}
+
+// DeregisterConfig implements apollo.Client.
+func (c *Client) DeregisterConfig(param apollo.ConfigParam, uniqueID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.callbacks[param.Key], uniqueID)
+	return nil
+}
+
+// Close implements apollo.Client.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.callbacks = map[string]map[int64]func(string, apollo.ConfigParser) error{}
+	return nil
+}
+
+// MetricsHook implements apollo.Client.
+func (c *Client) MetricsHook() apollo.MetricsHook {
+	return NoopMetricsHook{}
+}
+
+// Change updates the config of the category and notifies the callbacks.
+func (c *Client) Change(category, data string) {
+	c.mu.Lock()
+	c.data[category] = data
+	callbacks := make([]func(string, apollo.ConfigParser) error, 0, len(c.callbacks[category]))
+	for _, cb := range c.callbacks[category] {
+		callbacks = append(callbacks, cb)
+	}
+	c.mu.Unlock()
+	for _, cb := range callbacks {
+		cb(data, JSONParser{})
+	}
+}
+
+// Subscriptions returns the number of the registered callbacks.
+func (c *Client) Subscriptions() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, cbs := range c.callbacks {
+		n += len(cbs)
+	}
+	return n
+}
+
+// Subscribed reports whether the category is subscribed.
+func (c *Client) Subscribed(category string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.callbacks[category]) > 0
+}
+
+// Closed reports whether the client is closed.
+func (c *Client) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
@@ -0,0 +1,296 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// DefaultDebugTTL the expiry of the debug rules without expire_at, counted from when the rule is applied.
+const DefaultDebugTTL = time.Hour
+
+// DebugRule enables the debug logging of the matching requests until it expires. A rule matches
+// when all of its non-empty fields match.
+type DebugRule struct {
+	Methods []string `json:"methods"`
+	Callers []string `json:"callers"`
+	// ExpireAt the rule expires at, in RFC 3339, DefaultDebugTTL after it's applied if it's not set.
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+// Config the logging config.
+type Config struct {
+	// Level the global klog level: trace, debug, info, notice, warn, error or fatal. The level before is
+	// restored when it's removed or expires, and it's unchanged if it's always empty.
+	Level string `json:"level"`
+	// LevelExpireAt the level expires at, in RFC 3339, never if it's not set.
+	LevelExpireAt time.Time `json:"level_expire_at"`
+	// Debug the rules of the requests to log in debug.
+	Debug []*DebugRule `json:"debug"`
+}
+
+var levels = map[string]klog.Level{
+	"trace":  klog.LevelTrace,
+	"debug":  klog.LevelDebug,
+	"info":   klog.LevelInfo,
+	"notice": klog.LevelNotice,
+	"warn":   klog.LevelWarn,
+	"error":  klog.LevelError,
+	"fatal":  klog.LevelFatal,
+}
+
+// ParseLevel parses the klog level by name.
+func ParseLevel(name string) (klog.Level, error) {
+	lv, ok := levels[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %s", name)
+	}
+	return lv, nil
+}
+
+// DebugLogger writes the debug logs of the matching requests. It should not be filtered by the klog level,
+// or the debug logs are dropped when the level is above it, e.g. klog.CtxInfof at the warn level.
+type DebugLogger func(ctx context.Context, format string, v ...interface{})
+
+// NewDebugLogger returns the DebugLogger writing to w in the format of the default logger of klog,
+// whatever the klog level is.
+func NewDebugLogger(w io.Writer) DebugLogger {
+	logger := log.New(w, "", log.LstdFlags|log.Lshortfile|log.Lmicroseconds)
+	return func(ctx context.Context, format string, v ...interface{}) {
+		logger.Output(2, "[Debug] "+fmt.Sprintf(format, v...))
+	}
+}
+
+type debugRule struct {
+	methods  utils.Set
+	callers  utils.Set
+	expireAt time.Time
+}
+
+func toSet(values []string) utils.Set {
+	if len(values) == 0 {
+		return nil
+	}
+	s := utils.Set{}
+	for _, v := range values {
+		s[v] = true
+	}
+	return s
+}
+
+func (r *debugRule) match(now time.Time, method, caller string) bool {
+	if !now.Before(r.expireAt) {
+		return false
+	}
+	if r.methods != nil && !r.methods[method] {
+		return false
+	}
+	return r.callers == nil || r.callers[caller]
+}
+
+type debugCtxKey struct{}
+
+// DebugEnabled reports whether the request of the context matches a debug rule,
+// so the handlers could log more details for it.
+func DebugEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(debugCtxKey{}).(bool)
+	return enabled
+}
+
+// Controller sets the klog level and logs the matching requests by the config from apollo configuration center.
+type Controller struct {
+	apolloClient apollo.Client
+	param        apollo.ConfigParam
+	uniqueID     int64
+	rules        atomic.Value // []*debugRule
+	logger       atomic.Value // DebugLogger
+
+	mu         sync.Mutex // guards the following fields
+	baseLevel  klog.Level
+	levelSet   bool
+	levelTimer *time.Timer
+}
+
+// NewController subscribes the logging config of the service. The config is shared by the clients and
+// the servers of the process, install Middleware to them to enable the debug logging. baseLevel is the
+// klog level set at startup, which is restored when the level of the config is removed or expires.
+func NewController(service string, apolloClient apollo.Client, baseLevel klog.Level, opts utils.Options,
+) (*Controller, error) {
+	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.LoggingConfigName,
+		ServerServiceName: service,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	c := &Controller{
+		apolloClient: apolloClient,
+		param:        param,
+		uniqueID:     apollo.GetUniqueID(),
+		baseLevel:    baseLevel,
+	}
+	c.rules.Store([]*debugRule{})
+	c.logger.Store(NewDebugLogger(os.Stderr))
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		cfg := &Config{}
+		err := parser.Decode(param.Type, data, cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s apollo logging: unmarshal data %s failed: %s, skip...", service, data, err)
+			return err
+		}
+		if cfg.Level == "" {
+			c.setLevel(0, false, time.Time{})
+		} else if lv, err := ParseLevel(cfg.Level); err != nil {
+			klog.Warnf("[apollo] %s logging config is invalid: %s, skip...", service, err)
+			apolloClient.MetricsHook().ValidationRejected(apollo.LoggingConfigName)
+		} else {
+			c.setLevel(lv, true, cfg.LevelExpireAt)
+		}
+		now := time.Now()
+		rules := make([]*debugRule, 0, len(cfg.Debug))
+		for _, r := range cfg.Debug {
+			if r == nil {
+				continue
+			}
+			expireAt := r.ExpireAt
+			if expireAt.IsZero() {
+				expireAt = now.Add(DefaultDebugTTL)
+			}
+			rules = append(rules, &debugRule{methods: toSet(r.Methods), callers: toSet(r.Callers), expireAt: expireAt})
+		}
+		c.rules.Store(rules)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, c.uniqueID); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetDebugLogger replaces the logger of the debug logs, which writes to os.Stderr by default,
+// e.g. NewDebugLogger with the output set to klog.
+func (c *Controller) SetDebugLogger(logger DebugLogger) {
+	c.logger.Store(logger)
+}
+
+// setLevel sets the klog level until it expires, or restores the base level if it's not set.
+func (c *Controller) setLevel(lv klog.Level, set bool, expireAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.levelTimer != nil {
+		c.levelTimer.Stop()
+		c.levelTimer = nil
+	}
+	if !set || (!expireAt.IsZero() && !time.Now().Before(expireAt)) {
+		c.restoreLevel()
+		return
+	}
+	klog.SetLevel(lv)
+	c.levelSet = true
+	if expireAt.IsZero() {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(expireAt), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// the timer may fire after it's replaced by a newer config
+		if c.levelTimer == timer {
+			c.levelTimer = nil
+			c.restoreLevel()
+		}
+	})
+	c.levelTimer = timer
+}
+
+// restoreLevel restores the base level if the level is set by the config, it must be called with the lock held.
+func (c *Controller) restoreLevel() {
+	if c.levelSet {
+		klog.SetLevel(c.baseLevel)
+		c.levelSet = false
+	}
+}
+
+// Close cancels the config listener and restores the base level.
+func (c *Controller) Close() error {
+	err := c.apolloClient.DeregisterConfig(c.param, c.uniqueID)
+	c.setLevel(0, false, time.Time{})
+	return err
+}
+
+func (c *Controller) debug(ctx context.Context) (rpcinfo.RPCInfo, bool) {
+	rules := c.rules.Load().([]*debugRule)
+	if len(rules) == 0 {
+		return nil, false
+	}
+	ri := rpcinfo.GetRPCInfo(ctx)
+	if ri == nil {
+		return nil, false
+	}
+	var caller string
+	if from := ri.From(); from != nil {
+		caller = from.ServiceName()
+	}
+	now := time.Now()
+	for _, r := range rules {
+		if r.match(now, ri.To().Method(), caller) {
+			return ri, true
+		}
+	}
+	return nil, false
+}
+
+// Middleware logs the requests matching the debug rules, for both the clients and the servers.
+func (c *Controller) Middleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			ri, ok := c.debug(ctx)
+			if !ok {
+				return next(ctx, req, resp)
+			}
+			ctx = context.WithValue(ctx, debugCtxKey{}, true)
+			start := time.Now()
+			err := next(ctx, req, resp)
+			var caller string
+			if from := ri.From(); from != nil {
+				caller = from.ServiceName()
+			}
+			// the payloads are not logged as they may be large or sensitive
+			c.logger.Load().(DebugLogger)(ctx, "[apollo] debug: %s -> %s.%s cost=%s err=%v",
+				caller, ri.To().ServiceName(), ri.To().Method(), time.Since(start), err)
+			return err
+		}
+	}
+}
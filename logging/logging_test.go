@@ -0,0 +1,136 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// captureLogs redirects the klog output to the returned buffer until the test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	klog.SetOutput(buf)
+	t.Cleanup(func() {
+		klog.SetOutput(os.Stderr)
+		klog.SetLevel(klog.LevelTrace)
+	})
+	return buf
+}
+
+// debugLogged reports whether the debug logs are written at the current level.
+func debugLogged(buf *bytes.Buffer) bool {
+	buf.Reset()
+	klog.Debugf("probe")
+	return strings.Contains(buf.String(), "probe")
+}
+
+func TestLevelRestored(t *testing.T) {
+	buf := captureLogs(t)
+	klog.SetLevel(klog.LevelInfo)
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LoggingConfigName, `{"level": "debug"}`)
+	c, err := NewController("svc", cli, klog.LevelInfo, utils.Options{})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, debugLogged(buf), true)
+
+	// the base level is restored when the level is removed
+	cli.Change(apollo.LoggingConfigName, `{}`)
+	assert.Equal(t, debugLogged(buf), false)
+
+	// or when the controller is closed
+	cli.Change(apollo.LoggingConfigName, `{"level": "debug"}`)
+	assert.Equal(t, debugLogged(buf), true)
+	assert.Equal(t, c.Close(), nil)
+	assert.Equal(t, debugLogged(buf), false)
+}
+
+func TestLevelExpired(t *testing.T) {
+	buf := captureLogs(t)
+	klog.SetLevel(klog.LevelInfo)
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LoggingConfigName, `{}`)
+	c, err := NewController("svc", cli, klog.LevelInfo, utils.Options{})
+	assert.Equal(t, err, nil)
+
+	// the level is not restored if it's never set by the config
+	klog.SetLevel(klog.LevelDebug)
+	cli.Change(apollo.LoggingConfigName, `{}`)
+	assert.Equal(t, debugLogged(buf), true)
+	klog.SetLevel(klog.LevelInfo)
+
+	expireAt := time.Now().Add(50 * time.Millisecond).Format(time.RFC3339Nano)
+	cli.Change(apollo.LoggingConfigName, `{"level": "debug", "level_expire_at": "`+expireAt+`"}`)
+	assert.Equal(t, debugLogged(buf), true)
+	for i := 0; i < 100; i++ {
+		c.mu.Lock()
+		restored := c.levelTimer == nil
+		c.mu.Unlock()
+		if restored {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, debugLogged(buf), false)
+
+	// the expired level is not applied
+	cli.Change(apollo.LoggingConfigName, `{"level": "debug", "level_expire_at": "2020-01-01T00:00:00Z"}`)
+	assert.Equal(t, debugLogged(buf), false)
+}
+
+func TestMiddlewareLogsWithoutPayloads(t *testing.T) {
+	captureLogs(t)
+	// the debug logs are written whatever the klog level is
+	klog.SetLevel(klog.LevelWarn)
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LoggingConfigName, `{"debug": [{"methods": ["echo"], "callers": ["cli"]}]}`)
+	c, err := NewController("svc", cli, klog.LevelWarn, utils.Options{})
+	assert.Equal(t, err, nil)
+	buf := &bytes.Buffer{}
+	c.SetDebugLogger(NewDebugLogger(buf))
+
+	var debugged bool
+	ep := c.Middleware()(func(ctx context.Context, req, resp interface{}) error {
+		debugged = DebugEnabled(ctx)
+		return nil
+	})
+	call := func(caller, method string) {
+		ri := rpcinfo.NewRPCInfo(rpcinfo.NewEndpointInfo(caller, "", nil, nil),
+			rpcinfo.NewEndpointInfo("svc", method, nil, nil), rpcinfo.NewInvocation("svc", method), nil, nil)
+		buf.Reset()
+		ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), ri), "secret request", "secret response")
+	}
+
+	call("cli", "echo")
+	assert.Equal(t, debugged, true)
+	assert.Equal(t, strings.Contains(buf.String(), "cli -> svc.echo"), true)
+	assert.Equal(t, strings.Contains(buf.String(), "secret"), false)
+
+	call("other", "echo")
+	assert.Equal(t, debugged, false)
+	assert.Equal(t, buf.Len(), 0)
+}
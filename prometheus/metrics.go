@@ -0,0 +1,158 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+)
+
+const namespace = "kitex_config_apollo"
+
+var _ apollo.MetricsHook = &MetricsHook{}
+
+// MetricsHook the prometheus implementation of apollo.MetricsHook.
+type MetricsHook struct {
+	received      *prom.CounterVec
+	applied       *prom.CounterVec
+	decodeFailed  *prom.CounterVec
+	rejected      *prom.CounterVec
+	pollErrors    *prom.CounterVec
+	reconnects    *prom.CounterVec
+	subscriptions prom.Gauge
+	sinceSync     *prom.Desc
+
+	syncMutex sync.RWMutex
+	lastSync  map[string]time.Time
+}
+
+// NewMetricsHook creates the hook and registers its metrics to the registerer,
+// prom.DefaultRegisterer is used when it is nil.
+func NewMetricsHook(registerer prom.Registerer) (*MetricsHook, error) {
+	if registerer == nil {
+		registerer = prom.DefaultRegisterer
+	}
+	h := &MetricsHook{
+		received: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "config_received_total",
+			Help:      "Number of config updates received, by category.",
+		}, []string{"category"}),
+		applied: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "config_applied_total",
+			Help:      "Number of config updates applied, by category.",
+		}, []string{"category"}),
+		decodeFailed: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "config_decode_failures_total",
+			Help:      "Number of config updates failed to decode, by category.",
+		}, []string{"category"}),
+		rejected: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "config_validation_rejections_total",
+			Help:      "Number of config entries rejected by validation, by category.",
+		}, []string{"category"}),
+		pollErrors: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "long_poll_errors_total",
+			Help:      "Number of errors polling the config server, by namespace.",
+		}, []string{"namespace"}),
+		reconnects: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconnects_total",
+			Help:      "Number of successful polls after errors, by namespace.",
+		}, []string{"namespace"}),
+		subscriptions: prom.NewGauge(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_subscriptions",
+			Help:      "Number of active config subscriptions.",
+		}),
+		sinceSync: prom.NewDesc(prom.BuildFQName(namespace, "", "seconds_since_last_sync"),
+			"Seconds since the last successful sync, by namespace.", []string{"namespace"}, nil),
+		lastSync: make(map[string]time.Time),
+	}
+	for _, c := range []prom.Collector{
+		h.received, h.applied, h.decodeFailed, h.rejected,
+		h.pollErrors, h.reconnects, h.subscriptions, (*sinceSyncCollector)(h),
+	} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// ConfigReceived implements apollo.MetricsHook.
+func (h *MetricsHook) ConfigReceived(category string) {
+	h.received.WithLabelValues(category).Inc()
+}
+
+// ConfigApplied implements apollo.MetricsHook.
+func (h *MetricsHook) ConfigApplied(category string) {
+	h.applied.WithLabelValues(category).Inc()
+}
+
+// DecodeFailed implements apollo.MetricsHook.
+func (h *MetricsHook) DecodeFailed(category string) {
+	h.decodeFailed.WithLabelValues(category).Inc()
+}
+
+// ValidationRejected implements apollo.MetricsHook.
+func (h *MetricsHook) ValidationRejected(category string) {
+	h.rejected.WithLabelValues(category).Inc()
+}
+
+// LongPollError implements apollo.MetricsHook.
+func (h *MetricsHook) LongPollError(namespace string) {
+	h.pollErrors.WithLabelValues(namespace).Inc()
+}
+
+// Reconnected implements apollo.MetricsHook.
+func (h *MetricsHook) Reconnected(namespace string) {
+	h.reconnects.WithLabelValues(namespace).Inc()
+}
+
+// Synced implements apollo.MetricsHook.
+func (h *MetricsHook) Synced(namespace string, t time.Time) {
+	h.syncMutex.Lock()
+	h.lastSync[namespace] = t
+	h.syncMutex.Unlock()
+}
+
+// ActiveSubscriptions implements apollo.MetricsHook.
+func (h *MetricsHook) ActiveSubscriptions(n int) {
+	h.subscriptions.Set(float64(n))
+}
+
+// sinceSyncCollector computes the seconds since the last sync when collecting.
+type sinceSyncCollector MetricsHook
+
+func (c *sinceSyncCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.sinceSync
+}
+
+func (c *sinceSyncCollector) Collect(ch chan<- prom.Metric) {
+	now := time.Now()
+	c.syncMutex.RLock()
+	defer c.syncMutex.RUnlock()
+	for ns, t := range c.lastSync {
+		ch <- prom.MustNewConstMetric(c.sinceSync, prom.GaugeValue, now.Sub(t).Seconds(), ns)
+	}
+}
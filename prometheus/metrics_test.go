@@ -0,0 +1,88 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestMetricsHook(t *testing.T) {
+	registry := prom.NewRegistry()
+	h, err := NewMetricsHook(registry)
+	assert.Equal(t, err, nil)
+
+	h.ConfigReceived("retry")
+	h.ConfigReceived("retry")
+	h.ConfigApplied("retry")
+	h.DecodeFailed("limit")
+	h.ValidationRejected("circuit_break")
+	h.LongPollError("application")
+	h.Reconnected("application")
+	h.ActiveSubscriptions(3)
+
+	assert.Equal(t, testutil.ToFloat64(h.received.WithLabelValues("retry")), float64(2))
+	assert.Equal(t, testutil.ToFloat64(h.applied.WithLabelValues("retry")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(h.decodeFailed.WithLabelValues("limit")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(h.rejected.WithLabelValues("circuit_break")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(h.pollErrors.WithLabelValues("application")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(h.reconnects.WithLabelValues("application")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(h.subscriptions), float64(3))
+
+	// registering twice to the same registerer fails
+	_, err = NewMetricsHook(registry)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestSinceSyncCollector(t *testing.T) {
+	registry := prom.NewRegistry()
+	h, err := NewMetricsHook(registry)
+	assert.Equal(t, err, nil)
+
+	// nothing is reported before the first sync
+	assert.Equal(t, testutil.CollectAndCount((*sinceSyncCollector)(h)), 0)
+
+	h.Synced("application", time.Now().Add(-time.Minute))
+	h.Synced("other", time.Now())
+	assert.Equal(t, testutil.CollectAndCount((*sinceSyncCollector)(h)), 2)
+
+	families, err := registry.Gather()
+	assert.Equal(t, err, nil)
+	var found bool
+	for _, f := range families {
+		if f.GetName() != "kitex_config_apollo_seconds_since_last_sync" {
+			continue
+		}
+		found = true
+		for _, m := range f.GetMetric() {
+			v := m.GetGauge().GetValue()
+			switch m.GetLabel()[0].GetValue() {
+			case "application":
+				if v < 60 || v > 70 {
+					t.Errorf("unexpected seconds since last sync of application: %f", v)
+				}
+			case "other":
+				if v > 10 {
+					t.Errorf("unexpected seconds since last sync of other: %f", v)
+				}
+			}
+		}
+	}
+	assert.Equal(t, found, true)
+}
@@ -0,0 +1,278 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	kitexutils "github.com/cloudwego/kitex/pkg/utils"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// ErrNoInstance is returned by Resolve when there is no instance of the service in apollo.
+var ErrNoInstance = errors.New("no instance in apollo")
+
+const defaultNetwork = "tcp"
+
+// InstanceConfig an instance of the service.
+type InstanceConfig struct {
+	// Network the network of the address, tcp by default.
+	Network string `json:"network"`
+	// Address the host:port of the instance, or the path for the unix network.
+	Address string `json:"address"`
+	// Weight the weight for the load balancer, discovery.DefaultWeight if it's not set.
+	Weight int               `json:"weight"`
+	Tags   map[string]string `json:"tags"`
+}
+
+// Config the instance list of the service.
+type Config struct {
+	Instances []*InstanceConfig `json:"instances"`
+}
+
+// Validate checks the config.
+func (c *Config) Validate() error {
+	for i, ins := range c.Instances {
+		if ins == nil {
+			return fmt.Errorf("instance %d is empty", i)
+		}
+		if ins.Weight < 0 {
+			return fmt.Errorf("weight %d of instance %s must not be negative", ins.Weight, ins.Address)
+		}
+		if ins.Network != "" && ins.Network != defaultNetwork {
+			if ins.Address == "" {
+				return fmt.Errorf("address of instance %d is empty", i)
+			}
+			continue
+		}
+		if _, _, err := net.SplitHostPort(ins.Address); err != nil {
+			return fmt.Errorf("address of instance %d is invalid: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) instances() []discovery.Instance {
+	instances := make([]discovery.Instance, 0, len(c.Instances))
+	for _, ins := range c.Instances {
+		network, weight := ins.Network, ins.Weight
+		if network == "" {
+			network = defaultNetwork
+		}
+		if weight == 0 {
+			weight = discovery.DefaultWeight
+		}
+		instances = append(instances, &instance{
+			addr:   kitexutils.NewNetAddr(network, ins.Address),
+			weight: weight,
+			tags:   ins.Tags,
+		})
+	}
+	return instances
+}
+
+// instance implements discovery.Instance, and exposes the tags to compare the instances in Diff.
+type instance struct {
+	addr   net.Addr
+	weight int
+	tags   map[string]string
+}
+
+// Address implements discovery.Instance.
+func (i *instance) Address() net.Addr {
+	return i.addr
+}
+
+// Weight implements discovery.Instance.
+func (i *instance) Weight() int {
+	return i.weight
+}
+
+// Tag implements discovery.Instance.
+func (i *instance) Tag(key string) (value string, exist bool) {
+	value, exist = i.tags[key]
+	return
+}
+
+// Tags returns all the tags of the instance.
+func (i *instance) Tags() map[string]string {
+	return i.tags
+}
+
+// subscription the instance list of a service.
+type subscription struct {
+	param     apollo.ConfigParam
+	instances atomic.Value // []discovery.Instance
+}
+
+// ApolloResolver resolves the instances of the services from apollo configuration center, the instance
+// list of a service is subscribed when it's resolved for the first time. The changes are not pushed to
+// the clients, kitex resolves the service again on the periodic refresh of the load balancer cache.
+type ApolloResolver struct {
+	apolloClient apollo.Client
+	opts         utils.Options
+	uniqueID     int64
+
+	mu            sync.Mutex
+	subscriptions sync.Map // service -> *subscription
+}
+
+var _ discovery.Resolver = &ApolloResolver{}
+
+// NewApolloResolver creates the resolver, the instance list of a service is rendered with the server
+// key format, and could be customized by the ApolloCustomFunctions of opts.
+func NewApolloResolver(apolloClient apollo.Client, opts utils.Options) *ApolloResolver {
+	return &ApolloResolver{
+		apolloClient: apolloClient,
+		opts:         opts,
+		uniqueID:     apollo.GetUniqueID(),
+	}
+}
+
+// Target implements discovery.Resolver.
+func (r *ApolloResolver) Target(ctx context.Context, target rpcinfo.EndpointInfo) string {
+	return target.ServiceName()
+}
+
+// Resolve implements discovery.Resolver.
+func (r *ApolloResolver) Resolve(ctx context.Context, desc string) (discovery.Result, error) {
+	sub, err := r.subscribe(desc)
+	if err != nil {
+		return discovery.Result{}, err
+	}
+	instances := sub.instances.Load().([]discovery.Instance)
+	if len(instances) == 0 {
+		return discovery.Result{}, fmt.Errorf("resolve service %s failed: %w", desc, ErrNoInstance)
+	}
+	return discovery.Result{
+		Cacheable: true,
+		CacheKey:  desc,
+		Instances: instances,
+	}, nil
+}
+
+// Diff implements discovery.Resolver, the instances whose weight or tags changed are reported as updated.
+func (r *ApolloResolver) Diff(cacheKey string, prev, next discovery.Result) (discovery.Change, bool) {
+	ch, _ := discovery.DefaultDiff(cacheKey, prev, next)
+	prevMap := make(map[string]discovery.Instance, len(prev.Instances))
+	for _, ins := range prev.Instances {
+		prevMap[ins.Address().String()] = ins
+	}
+	for _, ins := range next.Instances {
+		if old, ok := prevMap[ins.Address().String()]; ok && !sameInstance(old, ins) {
+			ch.Updated = append(ch.Updated, ins)
+		}
+	}
+	return ch, len(ch.Added)+len(ch.Updated)+len(ch.Removed) != 0
+}
+
+// sameInstance reports whether the weight and the tags of the instances of the same address are equal.
+func sameInstance(a, b discovery.Instance) bool {
+	if a.Weight() != b.Weight() {
+		return false
+	}
+	ta, tb := tagsOf(a), tagsOf(b)
+	if len(ta) != len(tb) {
+		return false
+	}
+	for k, v := range ta {
+		if w, ok := tb[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// tagsOf returns the tags of the instances created by the resolver.
+func tagsOf(ins discovery.Instance) map[string]string {
+	if t, ok := ins.(interface{ Tags() map[string]string }); ok {
+		return t.Tags()
+	}
+	return nil
+}
+
+// Name implements discovery.Resolver.
+func (r *ApolloResolver) Name() string {
+	return "apollo"
+}
+
+// Close cancels the config listeners of the services.
+func (r *ApolloResolver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	r.subscriptions.Range(func(key, value interface{}) bool {
+		if err := r.apolloClient.DeregisterConfig(value.(*subscription).param, r.uniqueID); err != nil {
+			errs = append(errs, err)
+		}
+		r.subscriptions.Delete(key)
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+func (r *ApolloResolver) subscribe(service string) (*subscription, error) {
+	if sub, ok := r.subscriptions.Load(service); ok {
+		return sub.(*subscription), nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sub, ok := r.subscriptions.Load(service); ok {
+		return sub.(*subscription), nil
+	}
+	param, err := r.apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.DiscoveryConfigName,
+		ServerServiceName: service,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range r.opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	sub := &subscription{param: param}
+	sub.instances.Store([]discovery.Instance{})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		cfg := &Config{}
+		err := parser.Decode(param.Type, data, cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s apollo discovery: unmarshal data %s failed: %s, skip...", service, data, err)
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			klog.Warnf("[apollo] %s discovery config is invalid: %s, skip...", service, err)
+			return err
+		}
+		sub.instances.Store(cfg.instances())
+		return nil
+	}
+
+	if err := r.apolloClient.RegisterConfigCallback(param, onChangeCallback, r.uniqueID); err != nil {
+		return nil, err
+	}
+	r.subscriptions.Store(service, sub)
+	return sub, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/discovery"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// addresses returns the addresses of the resolved instances.
+func addresses(res discovery.Result) []string {
+	addrs := make([]string, 0, len(res.Instances))
+	for _, ins := range res.Instances {
+		addrs = append(addrs, ins.Address().String())
+	}
+	return addrs
+}
+
+func TestResolveNoInstance(t *testing.T) {
+	cli := apollotest.NewClient()
+	r := NewApolloResolver(cli, utils.Options{})
+
+	// no config of the service
+	_, err := r.Resolve(context.Background(), "svc")
+	assert.Equal(t, errors.Is(err, ErrNoInstance), true)
+
+	cli.Change(apollo.DiscoveryConfigName, `{"instances": []}`)
+	_, err = r.Resolve(context.Background(), "svc")
+	assert.Equal(t, errors.Is(err, ErrNoInstance), true)
+}
+
+func TestResolve(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.DiscoveryConfigName, `{"instances": [
+		{"address": "10.0.0.1:8888", "weight": 20, "tags": {"idc": "hl"}},
+		{"network": "unix", "address": "/tmp/svc.sock"}
+	]}`)
+	r := NewApolloResolver(cli, utils.Options{})
+	target := rpcinfo.NewEndpointInfo("svc", "echo", nil, nil)
+	assert.Equal(t, r.Target(context.Background(), target), "svc")
+
+	res, err := r.Resolve(context.Background(), "svc")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, res.Cacheable, true)
+	assert.Equal(t, res.CacheKey, "svc")
+	assert.Equal(t, addresses(res), []string{"10.0.0.1:8888", "/tmp/svc.sock"})
+	assert.Equal(t, res.Instances[0].Weight(), 20)
+	idc, ok := res.Instances[0].Tag("idc")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, idc, "hl")
+	assert.Equal(t, res.Instances[1].Address().Network(), "unix")
+	assert.Equal(t, res.Instances[1].Weight(), discovery.DefaultWeight)
+}
+
+func TestResolveInvalidConfig(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.DiscoveryConfigName, `{"instances": [{"address": "10.0.0.1:8888"}]}`)
+	r := NewApolloResolver(cli, utils.Options{})
+	_, err := r.Resolve(context.Background(), "svc")
+	assert.Equal(t, err, nil)
+
+	// the invalid instance list is rejected as a whole and the last one is kept
+	for _, data := range []string{
+		`{"instances": [{"address": "10.0.0.2"}]}`,
+		`{"instances": [{"address": "10.0.0.2:8888", "weight": -1}]}`,
+		`{"instances": [{"network": "unix"}]}`,
+		`{"instances": [null]}`,
+		`{"instances": "10.0.0.2:8888"}`,
+	} {
+		cli.Change(apollo.DiscoveryConfigName, data)
+		res, err := r.Resolve(context.Background(), "svc")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, addresses(res), []string{"10.0.0.1:8888"})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.DiscoveryConfigName, `{"instances": [
+		{"address": "10.0.0.1:8888", "weight": 20, "tags": {"idc": "hl"}},
+		{"address": "10.0.0.2:8888"}
+	]}`)
+	r := NewApolloResolver(cli, utils.Options{})
+	prev, err := r.Resolve(context.Background(), "svc")
+	assert.Equal(t, err, nil)
+
+	// nothing changed
+	next, _ := r.Resolve(context.Background(), "svc")
+	_, changed := r.Diff("svc", prev, next)
+	assert.Equal(t, changed, false)
+
+	// the weight changed
+	cli.Change(apollo.DiscoveryConfigName, `{"instances": [
+		{"address": "10.0.0.1:8888", "weight": 30, "tags": {"idc": "hl"}},
+		{"address": "10.0.0.2:8888"}
+	]}`)
+	next, _ = r.Resolve(context.Background(), "svc")
+	ch, changed := r.Diff("svc", prev, next)
+	assert.Equal(t, changed, true)
+	assert.Equal(t, addresses(discovery.Result{Instances: ch.Updated}), []string{"10.0.0.1:8888"})
+	assert.Equal(t, len(ch.Added), 0)
+	assert.Equal(t, len(ch.Removed), 0)
+
+	// the tags changed
+	cli.Change(apollo.DiscoveryConfigName, `{"instances": [
+		{"address": "10.0.0.1:8888", "weight": 20, "tags": {"idc": "lf"}},
+		{"address": "10.0.0.2:8888", "tags": {"idc": "hl"}}
+	]}`)
+	next, _ = r.Resolve(context.Background(), "svc")
+	ch, changed = r.Diff("svc", prev, next)
+	assert.Equal(t, changed, true)
+	assert.Equal(t, addresses(discovery.Result{Instances: ch.Updated}), []string{"10.0.0.1:8888", "10.0.0.2:8888"})
+
+	// the instances added and removed
+	cli.Change(apollo.DiscoveryConfigName, `{"instances": [
+		{"address": "10.0.0.1:8888", "weight": 20, "tags": {"idc": "hl"}},
+		{"address": "10.0.0.3:8888"}
+	]}`)
+	next, _ = r.Resolve(context.Background(), "svc")
+	ch, changed = r.Diff("svc", prev, next)
+	assert.Equal(t, changed, true)
+	assert.Equal(t, len(ch.Updated), 0)
+	assert.Equal(t, addresses(discovery.Result{Instances: ch.Added}), []string{"10.0.0.3:8888"})
+	assert.Equal(t, addresses(discovery.Result{Instances: ch.Removed}), []string{"10.0.0.2:8888"})
+}
+
+func TestClose(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.DiscoveryConfigName, `{"instances": [{"address": "10.0.0.1:8888"}]}`)
+	r := NewApolloResolver(cli, utils.Options{})
+	_, err := r.Resolve(context.Background(), "svc")
+	assert.Equal(t, err, nil)
+	// the service is subscribed once
+	_, err = r.Resolve(context.Background(), "svc")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cli.Subscriptions(), 1)
+
+	assert.Equal(t, r.Close(), nil)
+	assert.Equal(t, cli.Subscriptions(), 0)
+
+	// the service is subscribed again when it's resolved after Close
+	_, err = r.Resolve(context.Background(), "svc")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cli.Subscriptions(), 1)
+}
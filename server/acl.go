@@ -0,0 +1,308 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/server"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// The actions of the ACL config.
+const (
+	ACLActionAllow = "allow"
+	ACLActionDeny  = "deny"
+)
+
+// ACLRule matches a request when all of its non-empty fields match, and a field matches when
+// any of its values matches.
+type ACLRule struct {
+	// CIDRs the CIDR ranges or IPs of the remote address.
+	CIDRs []string `json:"cidrs"`
+	// Callers the caller service names.
+	Callers []string `json:"callers"`
+	// Methods the methods called.
+	Methods []string `json:"methods"`
+}
+
+// ACLConfig the allowlist and denylist of the server.
+type ACLConfig struct {
+	Allow []*ACLRule `json:"allow"`
+	Deny  []*ACLRule `json:"deny"`
+	// Precedence the action when both the allow and deny rules match, deny by default.
+	Precedence string `json:"precedence"`
+	// DefaultAction the action when no rule matches, deny if there are allow rules, or allow otherwise.
+	DefaultAction string `json:"default_action"`
+	// DryRun only logs the denied requests without rejecting them.
+	DryRun bool `json:"dry_run"`
+}
+
+type aclRule struct {
+	nets    []*net.IPNet
+	callers utils.Set
+	methods utils.Set
+}
+
+func newACLRule(r *ACLRule) (*aclRule, error) {
+	rule := &aclRule{}
+	for _, cidr := range r.CIDRs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %s", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			rule.nets = append(rule.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		rule.nets = append(rule.nets, n)
+	}
+	if len(r.Callers) > 0 {
+		rule.callers = utils.Set{}
+		for _, c := range r.Callers {
+			rule.callers[c] = true
+		}
+	}
+	if len(r.Methods) > 0 {
+		rule.methods = utils.Set{}
+		for _, m := range r.Methods {
+			rule.methods[m] = true
+		}
+	}
+	return rule, nil
+}
+
+func (r *aclRule) match(ip net.IP, caller, method string) bool {
+	if len(r.nets) > 0 {
+		if ip == nil {
+			return false
+		}
+		matched := false
+		for _, n := range r.nets {
+			if n.Contains(ip) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if r.callers != nil && !r.callers[caller] {
+		return false
+	}
+	if r.methods != nil && !r.methods[method] {
+		return false
+	}
+	return true
+}
+
+// acl the compiled ACLConfig.
+type acl struct {
+	allow         []*aclRule
+	deny          []*aclRule
+	precedence    string
+	defaultAction string
+	dryRun        bool
+}
+
+func newACL(cfg *ACLConfig) (*acl, error) {
+	a := &acl{precedence: ACLActionDeny, defaultAction: cfg.DefaultAction, dryRun: cfg.DryRun}
+	switch cfg.Precedence {
+	case "", ACLActionDeny:
+	case ACLActionAllow:
+		a.precedence = ACLActionAllow
+	default:
+		return nil, fmt.Errorf("unknown precedence %s", cfg.Precedence)
+	}
+	for _, r := range cfg.Allow {
+		if r == nil {
+			continue
+		}
+		rule, err := newACLRule(r)
+		if err != nil {
+			return nil, err
+		}
+		a.allow = append(a.allow, rule)
+	}
+	for _, r := range cfg.Deny {
+		if r == nil {
+			continue
+		}
+		rule, err := newACLRule(r)
+		if err != nil {
+			return nil, err
+		}
+		a.deny = append(a.deny, rule)
+	}
+	switch a.defaultAction {
+	case ACLActionAllow, ACLActionDeny:
+	case "":
+		a.defaultAction = ACLActionAllow
+		if len(a.allow) > 0 {
+			a.defaultAction = ACLActionDeny
+		}
+	default:
+		return nil, fmt.Errorf("unknown default_action %s", cfg.DefaultAction)
+	}
+	return a, nil
+}
+
+func matchAny(rules []*aclRule, ip net.IP, caller, method string) bool {
+	for _, r := range rules {
+		if r.match(ip, caller, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether the request is allowed by the rules, dry run is not considered.
+func (a *acl) allowed(ip net.IP, caller, method string) bool {
+	allow := matchAny(a.allow, ip, caller, method)
+	deny := matchAny(a.deny, ip, caller, method)
+	switch {
+	case allow && deny:
+		return a.precedence == ACLActionAllow
+	case allow:
+		return true
+	case deny:
+		return false
+	}
+	return a.defaultAction == ACLActionAllow
+}
+
+// WithACL allows or denies the requests by the config from apollo configuration center.
+// It panics when failed, use WithACLE to handle the error.
+func WithACL(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) server.Option {
+	option, err := WithACLE(dest, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return option
+}
+
+// WithACLE allows or denies the requests by the config from apollo configuration center.
+func WithACLE(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) (server.Option, error) {
+	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.ACLConfigName,
+		ServerServiceName: dest,
+	})
+	if err != nil {
+		return server.Option{}, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	uniqueID := apollo.GetUniqueID()
+	var current atomic.Value // *acl
+	current.Store(&acl{defaultAction: ACLActionAllow})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		cfg := &ACLConfig{}
+		err := parser.Decode(param.Type, data, cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s server apollo acl: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		a, err := newACL(cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s server acl config is invalid: %s, skip...", dest, err)
+			return err
+		}
+		current.Store(a)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return server.Option{}, err
+	}
+	server.RegisterShutdownHook(func() {
+		apolloClient.DeregisterConfig(param, uniqueID)
+	})
+	return server.WithMiddleware(aclMiddleware(dest, &current)), nil
+}
+
+func aclMiddleware(dest string, current *atomic.Value) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			a := current.Load().(*acl)
+			if len(a.allow) == 0 && len(a.deny) == 0 && a.defaultAction == ACLActionAllow {
+				return next(ctx, req, resp)
+			}
+			ri := rpcinfo.GetRPCInfo(ctx)
+			if ri == nil {
+				return next(ctx, req, resp)
+			}
+			var (
+				ip     net.IP
+				caller string
+				method = ri.To().Method()
+			)
+			if from := ri.From(); from != nil {
+				caller = from.ServiceName()
+				ip = remoteIP(from.Address())
+			}
+			if a.allowed(ip, caller, method) {
+				return next(ctx, req, resp)
+			}
+			if a.dryRun {
+				klog.CtxWarnf(ctx, "[apollo] %s server acl dry run: caller %s from %s calling %s would be denied",
+					dest, caller, ip, method)
+				return next(ctx, req, resp)
+			}
+			return kerrors.ErrACL.WithCause(fmt.Errorf("caller %s from %s calling %s is denied", caller, ip, method))
+		}
+	}
+}
+
+func remoteIP(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return net.ParseIP(host)
+}
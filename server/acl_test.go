@@ -0,0 +1,107 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/utils"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func mustNewACL(t *testing.T, cfg *ACLConfig) *acl {
+	a, err := newACL(cfg)
+	assert.Equal(t, err, nil)
+	return a
+}
+
+func TestACLPrecedence(t *testing.T) {
+	cfg := &ACLConfig{
+		Allow: []*ACLRule{{Callers: []string{"a", "b"}}},
+		Deny:  []*ACLRule{{Callers: []string{"b"}, Methods: []string{"echo"}}},
+	}
+	a := mustNewACL(t, cfg)
+	assert.Equal(t, a.allowed(nil, "a", "echo"), true)
+	// deny takes precedence by default
+	assert.Equal(t, a.allowed(nil, "b", "echo"), false)
+	assert.Equal(t, a.allowed(nil, "b", "other"), true)
+	// deny by default when there are allow rules
+	assert.Equal(t, a.allowed(nil, "c", "echo"), false)
+
+	cfg.Precedence = ACLActionAllow
+	a = mustNewACL(t, cfg)
+	assert.Equal(t, a.allowed(nil, "b", "echo"), true)
+
+	// allow by default with only deny rules
+	a = mustNewACL(t, &ACLConfig{Deny: cfg.Deny})
+	assert.Equal(t, a.allowed(nil, "b", "echo"), false)
+	assert.Equal(t, a.allowed(nil, "c", "echo"), true)
+
+	cfg.DefaultAction = ACLActionAllow
+	a = mustNewACL(t, cfg)
+	assert.Equal(t, a.allowed(nil, "c", "echo"), true)
+}
+
+func TestACLCIDR(t *testing.T) {
+	a := mustNewACL(t, &ACLConfig{
+		Allow: []*ACLRule{{CIDRs: []string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"}}},
+	})
+	assert.Equal(t, a.allowed(net.ParseIP("10.1.2.3"), "", "echo"), true)
+	assert.Equal(t, a.allowed(net.ParseIP("11.1.2.3"), "", "echo"), false)
+	// a single ip matches itself only
+	assert.Equal(t, a.allowed(net.ParseIP("192.168.1.1"), "", "echo"), true)
+	assert.Equal(t, a.allowed(net.ParseIP("192.168.1.2"), "", "echo"), false)
+	assert.Equal(t, a.allowed(net.ParseIP("fd12::1"), "", "echo"), true)
+	// no address matches no cidr rule
+	assert.Equal(t, a.allowed(nil, "", "echo"), false)
+}
+
+func TestACLInvalid(t *testing.T) {
+	for _, cfg := range []*ACLConfig{
+		{Allow: []*ACLRule{{CIDRs: []string{"10.0.0.0/33"}}}},
+		{Deny: []*ACLRule{{CIDRs: []string{"not an ip"}}}},
+		{Precedence: "unknown"},
+		{DefaultAction: "unknown"},
+	} {
+		_, err := newACL(cfg)
+		assert.NotEqual(t, err, nil)
+	}
+}
+
+func TestACLMiddleware(t *testing.T) {
+	var current atomic.Value
+	current.Store(mustNewACL(t, &ACLConfig{Deny: []*ACLRule{{CIDRs: []string{"10.0.0.0/8"}}}}))
+	ep := aclMiddleware("svc", &current)(noopEndpoint)
+	call := func(addr string) error {
+		from := rpcinfo.NewEndpointInfo("cli", "", utils.NewNetAddr("tcp", addr), nil)
+		ri := rpcinfo.NewRPCInfo(from, rpcinfo.NewEndpointInfo("svc", "echo", nil, nil),
+			rpcinfo.NewInvocation("svc", "echo"), nil, nil)
+		return ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), ri), nil, nil)
+	}
+
+	err := call("10.1.2.3:8888")
+	assert.Equal(t, errors.Is(err, kerrors.ErrACL), true)
+	assert.Equal(t, call("11.1.2.3:8888"), nil)
+
+	// the denied requests are served in dry run
+	current.Store(mustNewACL(t, &ACLConfig{Deny: []*ACLRule{{CIDRs: []string{"10.0.0.0/8"}}}, DryRun: true}))
+	assert.Equal(t, call("10.1.2.3:8888"), nil)
+}
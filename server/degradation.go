@@ -0,0 +1,124 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/server"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// WithDegradation rejects the requests of the degraded methods by the config from apollo configuration center.
+// It panics when failed, use WithDegradationE to handle the error.
+func WithDegradation(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) server.Option {
+	option, err := WithDegradationE(dest, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return option
+}
+
+// WithDegradationE rejects the requests of the degraded methods by the config from apollo configuration center.
+func WithDegradationE(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) (server.Option, error) {
+	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.DegradationConfigName,
+		ServerServiceName: dest,
+	})
+	if err != nil {
+		return server.Option{}, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	uniqueID := apollo.GetUniqueID()
+	container, err := initDegradationContainer(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return server.Option{}, err
+	}
+	server.RegisterShutdownHook(func() {
+		apolloClient.DeregisterConfig(param, uniqueID)
+	})
+	return server.WithMiddleware(degradationMiddleware(container)), nil
+}
+
+func degradationMiddleware(container *utils.DegradationContainer) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			if ri := rpcinfo.GetRPCInfo(ctx); ri != nil {
+				if err := container.Reject(ri.To().Method()); err != nil {
+					return reject(ri, err)
+				}
+			}
+			return next(ctx, req, resp)
+		}
+	}
+}
+
+// reject returns the error of the rejected request. Kitex only sets the biz status errors returned by
+// the handler to the response, so the ones returned by the middlewares are set to the invocation here
+// for the callers to receive the code and the message.
+func reject(ri rpcinfo.RPCInfo, err error) error {
+	if bizErr, ok := kerrors.FromBizStatusError(err); ok {
+		if setter, ok := ri.Invocation().(rpcinfo.InvocationSetter); ok {
+			setter.SetBizStatusErr(bizErr)
+			return nil
+		}
+	}
+	return err
+}
+
+func initDegradationContainer(param apollo.ConfigParam, dest string,
+	apolloClient apollo.Client, uniqueID int64,
+) (*utils.DegradationContainer, error) {
+	container := utils.NewDegradationContainer()
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		configs := map[string]*utils.DegradationConfig{}
+		err := parser.Decode(param.Type, data, &configs)
+		if err != nil {
+			klog.Warnf("[apollo] %s server apollo degradation: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		for method, cfg := range configs {
+			if cfg == nil {
+				delete(configs, method)
+				continue
+			}
+			if err := cfg.Validate(); err != nil {
+				klog.Warnf("[apollo] %s server degradation for method %s is invalid: %s, skip...", dest, method, err)
+				apolloClient.MetricsHook().ValidationRejected(apollo.DegradationConfigName)
+				delete(configs, method)
+			}
+		}
+		container.NotifyPolicyChange(configs)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
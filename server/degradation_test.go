@@ -0,0 +1,127 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex-examples/kitex_gen/api"
+	"github.com/cloudwego/kitex-examples/kitex_gen/api/echo"
+	"github.com/cloudwego/kitex/client"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/pkg/transmeta"
+	"github.com/cloudwego/kitex/server"
+	"github.com/cloudwego/kitex/transport"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+type echoImpl struct{}
+
+func (*echoImpl) Echo(ctx context.Context, req *api.Request) (*api.Response, error) {
+	return &api.Response{Message: req.Message}, nil
+}
+
+// runEchoServer starts an echo server with the options and returns a client calling it,
+// the biz status errors are transmitted by TTHeader.
+func runEchoServer(t *testing.T, opts ...server.Option) echo.Client {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	addr := ln.Addr()
+	ln.Close()
+
+	opts = append(opts,
+		server.WithServiceAddr(addr),
+		server.WithMetaHandler(transmeta.ServerTTHeaderHandler),
+		server.WithServerBasicInfo(&rpcinfo.EndpointBasicInfo{ServiceName: "svc"}),
+	)
+	svr := echo.NewServer(&echoImpl{}, opts...)
+	go svr.Run()
+	t.Cleanup(func() { svr.Stop() })
+
+	cli, err := echo.NewClient("svc",
+		client.WithHostPorts(addr.String()),
+		client.WithTransportProtocol(transport.TTHeader),
+		client.WithMetaHandler(transmeta.ClientTTHeaderHandler),
+		client.WithClientBasicInfo(&rpcinfo.EndpointBasicInfo{ServiceName: "cli"}),
+	)
+	assert.Equal(t, err, nil)
+	// wait for the server to listen
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr.String()); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cli
+}
+
+func TestDegradationBizStatusError(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.DegradationConfigName, `{"echo": {"enabled": true, "error_code": 1001, "message": "degraded"}}`)
+	option, err := WithDegradationE("svc", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+	echoCli := runEchoServer(t, option)
+
+	_, err = echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	bizErr, ok := kerrors.FromBizStatusError(err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, bizErr.BizStatusCode(), int32(1001))
+	assert.Equal(t, bizErr.BizMessage(), "degraded")
+
+	// the requests are rejected by the plain error without error_code
+	cli.Change(apollo.DegradationConfigName, `{"echo": {"enabled": true}}`)
+	_, err = echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	assert.NotEqual(t, err, nil)
+	_, ok = kerrors.FromBizStatusError(err)
+	assert.Equal(t, ok, false)
+
+	cli.Change(apollo.DegradationConfigName, `{}`)
+	resp, err := echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.Message, "hello")
+}
+
+func TestDegradationMiddleware(t *testing.T) {
+	container := utils.NewDegradationContainer()
+	called := false
+	next := func(ctx context.Context, req, resp interface{}) error {
+		called = true
+		return nil
+	}
+	ep := degradationMiddleware(container)(next)
+
+	container.NotifyPolicyChange(map[string]*utils.DegradationConfig{"*": {Enabled: true}})
+	ri := rpcinfo.NewRPCInfo(nil, rpcinfo.NewEndpointInfo("svc", "Echo", nil, nil),
+		rpcinfo.NewInvocation("svc", "Echo"), nil, nil)
+	err := ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), ri), nil, nil)
+	assert.Equal(t, errors.Is(err, utils.ErrDegraded), true)
+	assert.Equal(t, called, false)
+
+	container.NotifyPolicyChange(map[string]*utils.DegradationConfig{"*": {Enabled: true, ErrorCode: 1001}})
+	err = ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), ri), nil, nil)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ri.Invocation().BizStatusErr().BizStatusCode(), int32(1001))
+	assert.Equal(t, called, false)
+}
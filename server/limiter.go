@@ -15,65 +15,227 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"sync/atomic"
 
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
 	"github.com/cloudwego/kitex/pkg/klog"
 	"github.com/cloudwego/kitex/pkg/limit"
 	"github.com/cloudwego/kitex/pkg/limiter"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
 	"github.com/cloudwego/kitex/server"
 
 	"github.com/kitex-contrib/config-apollo/apollo"
 	"github.com/kitex-contrib/config-apollo/utils"
 )
 
+// MethodLimitConfig the QPS limit of a method.
+type MethodLimitConfig struct {
+	// QPSLimit the max requests per second of the method, no limit if it's not positive.
+	QPSLimit int64 `json:"qps_limit"`
+	// Burst the max requests allowed at once, qps_limit by default.
+	Burst int `json:"burst"`
+}
+
+// Validate checks the config.
+func (c *MethodLimitConfig) Validate() error {
+	if c.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	return nil
+}
+
+// limiterConfig the limiter document, the global limits with the per-method limits.
+type limiterConfig struct {
+	limiter.LimiterConfig
+	// Algorithm the algorithm of the global QPS limit, the built-in limiter of kitex by default.
+	Algorithm string `json:"algorithm"`
+	// Burst the max requests allowed at once by the token bucket, qps_limit by default.
+	Burst int `json:"burst"`
+	// ConcurrencyLimit the max in-flight requests of the concurrency algorithm.
+	ConcurrencyLimit int64                         `json:"concurrency_limit"`
+	Methods          map[string]*MethodLimitConfig `json:"methods"`
+}
+
 // WithLimiter sets the limiter config from apollo configuration center.
+// It panics when failed, use WithLimiterE to handle the error.
 func WithLimiter(dest string, apolloClient apollo.Client,
 	opts utils.Options,
 ) server.Option {
+	option, err := WithLimiterE(dest, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return option
+}
+
+// WithLimiterE sets the limiter config from apollo configuration center.
+func WithLimiterE(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) (server.Option, error) {
 	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
 		Category:          apollo.LimiterConfigName,
 		ServerServiceName: dest,
 	})
 	if err != nil {
-		panic(err)
+		return server.Option{}, err
 	}
 	for _, f := range opts.ApolloCustomFunctions {
 		f(&param)
 	}
 	uniqueID := apollo.GetUniqueID()
+	opt, sl, err := initLimitOptions(param, dest, apolloClient, uniqueID, opts.LimiterAlgorithms)
+	if err != nil {
+		return server.Option{}, err
+	}
 	server.RegisterShutdownHook(func() {
 		apolloClient.DeregisterConfig(param, uniqueID)
 	})
-	return server.WithLimit(initLimitOptions(param, dest, apolloClient, uniqueID))
+	options := serverOptions{server.WithLimit(opt), server.WithMiddleware(sl.middleware)}
+	if sl.qps != nil {
+		options = append(options, server.WithQPSLimiter(sl.qps))
+	}
+	return server.WithSuite(options), nil
 }
 
-func initLimitOptions(param apollo.ConfigParam, dest string, apolloClient apollo.Client, uniqueID int64) *limit.Option {
+// serverOptions combines the options into one.
+type serverOptions []server.Option
+
+// Options implements server.Suite.
+func (o serverOptions) Options() []server.Option {
+	return o
+}
+
+// serverLimiters the global QPS limiter, the in-flight requests and the per-method token buckets.
+type serverLimiters struct {
+	// qps the QPS limiter of the selected algorithm, nil if the algorithms are not enabled
+	// and the built-in limiter of kitex is used.
+	qps *switchableLimiter
+	// inflight is counted whatever the algorithm is, so the concurrency algorithm
+	// starts with the requests in flight when switched to.
+	inflight    int64
+	concurrency int64        // the concurrency limit, no limit if it's not positive
+	buckets     atomic.Value // map[string]*utils.TokenBucket, swapped as a whole when the config changes
+}
+
+func newServerLimiters(algorithms bool) *serverLimiters {
+	sl := &serverLimiters{}
+	if algorithms {
+		sl.qps = newSwitchableLimiter()
+	}
+	sl.buckets.Store(map[string]*utils.TokenBucket{})
+	return sl
+}
+
+func (sl *serverLimiters) updateConcurrency(algorithm string, limit int64) {
+	if algorithm != LimiterAlgorithmConcurrency {
+		limit = 0
+	}
+	atomic.StoreInt64(&sl.concurrency, limit)
+}
+
+// updateMethods keeps the buckets of the methods still limited so their tokens are not reset.
+func (sl *serverLimiters) updateMethods(configs map[string]*MethodLimitConfig) {
+	old := sl.buckets.Load().(map[string]*utils.TokenBucket)
+	buckets := make(map[string]*utils.TokenBucket, len(configs))
+	for method, c := range configs {
+		if c.QPSLimit <= 0 {
+			continue
+		}
+		if b, ok := old[method]; ok {
+			b.SetLimit(float64(c.QPSLimit), c.Burst)
+			buckets[method] = b
+			continue
+		}
+		buckets[method] = utils.NewTokenBucket(float64(c.QPSLimit), c.Burst)
+	}
+	sl.buckets.Store(buckets)
+}
+
+func (sl *serverLimiters) middleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, req, resp interface{}) error {
+		inflight := atomic.AddInt64(&sl.inflight, 1)
+		defer atomic.AddInt64(&sl.inflight, -1)
+		if limit := atomic.LoadInt64(&sl.concurrency); limit > 0 && inflight > limit {
+			return kerrors.ErrOverlimit.WithCause(fmt.Errorf("too many concurrent requests, limit %d", limit))
+		}
+		buckets := sl.buckets.Load().(map[string]*utils.TokenBucket)
+		if len(buckets) != 0 {
+			if ri := rpcinfo.GetRPCInfo(ctx); ri != nil {
+				if b, ok := buckets[ri.To().Method()]; ok && !b.Allow() {
+					return kerrors.ErrQPSOverLimit
+				}
+			}
+		}
+		return next(ctx, req, resp)
+	}
+}
+
+func initLimitOptions(param apollo.ConfigParam, dest string, apolloClient apollo.Client, uniqueID int64,
+	algorithms bool,
+) (*limit.Option, *serverLimiters, error) {
 	var updater atomic.Value
+	sl := newServerLimiters(algorithms)
 	opt := &limit.Option{}
 	opt.UpdateControl = func(u limit.Updater) {
 		klog.Debugf("[apollo] %s server apollo limiter updater init, config %v", dest, *opt)
 		u.UpdateLimit(opt)
 		updater.Store(u)
 	}
-	onChangeCallback := func(data string, parser apollo.ConfigParser) {
-		lc := &limiter.LimiterConfig{}
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		lc := &limiterConfig{}
 		err := parser.Decode(param.Type, data, lc)
 		if err != nil {
 			klog.Warnf("[apollo] %s server apollo limiter config: unmarshal data %s failed: %s, skip...", dest, data, err)
-			return
+			return err
+		}
+		for method, c := range lc.Methods {
+			if c == nil {
+				delete(lc.Methods, method)
+				continue
+			}
+			if err := c.Validate(); err != nil {
+				klog.Warnf("[apollo] %s server limiter for method %s is invalid: %s, skip...", dest, method, err)
+				apolloClient.MetricsHook().ValidationRejected(apollo.LimiterConfigName)
+				delete(lc.Methods, method)
+			}
 		}
+		sl.updateMethods(lc.Methods)
+		switch {
+		case sl.qps == nil:
+			if lc.Algorithm != LimiterAlgorithmDefault {
+				klog.Warnf("[apollo] %s server limiter algorithm %s is not enabled by utils.EnableLimiterAlgorithms, "+
+					"use the built-in limiter", dest, lc.Algorithm)
+				apolloClient.MetricsHook().ValidationRejected(apollo.LimiterConfigName)
+				lc.Algorithm = LimiterAlgorithmDefault
+			}
+		case !validAlgorithm(lc.Algorithm):
+			algorithm := sl.qps.currentAlgorithm()
+			klog.Warnf("[apollo] %s server limiter algorithm %s is not registered, keep %q", dest, lc.Algorithm, algorithm)
+			apolloClient.MetricsHook().ValidationRejected(apollo.LimiterConfigName)
+			lc.Algorithm = algorithm
+			fallthrough
+		default:
+			sl.qps.update(lc.Algorithm, int(lc.QPSLimit), lc.Burst)
+		}
+		sl.updateConcurrency(lc.Algorithm, lc.ConcurrencyLimit)
 		opt.MaxConnections = int(lc.ConnectionLimit)
 		opt.MaxQPS = int(lc.QPSLimit)
 		u := updater.Load()
 		if u == nil {
 			klog.Warnf("[apollo] %s server apollo limiter config failed as the updater is empty", dest)
-			return
+			return nil
 		}
 		if !u.(limit.Updater).UpdateLimit(opt) {
 			klog.Warnf("[apollo] %s server apollo limiter config: data %s may do not take affect", dest, data)
 		}
+		return nil
 	}
 
-	apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID)
-	return opt
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, nil, err
+	}
+	return opt, sl, nil
 }
@@ -0,0 +1,299 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/limiter"
+
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// The limiter algorithms of the limiter document.
+const (
+	// LimiterAlgorithmDefault the built-in QPS limiter of kitex.
+	LimiterAlgorithmDefault = ""
+	// LimiterAlgorithmTokenBucket a token bucket with the burst.
+	LimiterAlgorithmTokenBucket = "token_bucket"
+	// LimiterAlgorithmSlidingWindow a sliding window of one second.
+	LimiterAlgorithmSlidingWindow = "sliding_window"
+	// LimiterAlgorithmConcurrency limits the in-flight requests by concurrency_limit instead of the QPS.
+	LimiterAlgorithmConcurrency = "concurrency"
+)
+
+// RateLimiterFactory creates the custom rate limiter with the qps_limit and burst of the limiter document.
+// The limiter is updated by UpdateLimit if it implements limiter.Updatable, or recreated otherwise.
+type RateLimiterFactory func(qpsLimit, burst int) limiter.RateLimiter
+
+var (
+	rateLimiterMutex     sync.RWMutex
+	rateLimiterFactories = map[string]RateLimiterFactory{}
+)
+
+// RegisterRateLimiter registers the custom rate limiter with name, which could be selected by the
+// algorithm of the limiter document. It should be called before the servers are created.
+func RegisterRateLimiter(name string, factory RateLimiterFactory) {
+	rateLimiterMutex.Lock()
+	defer rateLimiterMutex.Unlock()
+	rateLimiterFactories[name] = factory
+}
+
+func getRateLimiter(name string) (RateLimiterFactory, bool) {
+	rateLimiterMutex.RLock()
+	defer rateLimiterMutex.RUnlock()
+	f, ok := rateLimiterFactories[name]
+	return f, ok
+}
+
+func validAlgorithm(name string) bool {
+	switch name {
+	case LimiterAlgorithmDefault, LimiterAlgorithmTokenBucket, LimiterAlgorithmSlidingWindow, LimiterAlgorithmConcurrency:
+		return true
+	}
+	_, ok := getRateLimiter(name)
+	return ok
+}
+
+// available is implemented by the limiters whose remaining quota could be carried over.
+type available interface {
+	setAvailable(n int)
+}
+
+// switchableLimiter the QPS limiter of the server, which delegates to the limiter of the selected
+// algorithm and switches it at runtime. It's installed only when the algorithms are enabled by
+// utils.EnableLimiterAlgorithms, as kitex checks the installed limiter after decoding the request
+// instead of before, so the rejected requests are decoded in vain.
+type switchableLimiter struct {
+	current atomic.Value // rateLimiterHolder
+
+	mu        sync.Mutex // guards the following fields
+	algorithm string
+	qpsLimit  int
+	burst     int
+	builtin   limiter.RateLimiter
+}
+
+var _ limiter.RateLimiter = &switchableLimiter{}
+
+// rateLimiterHolder keeps the type stored in atomic.Value consistent.
+type rateLimiterHolder struct {
+	limiter.RateLimiter
+}
+
+func newSwitchableLimiter() *switchableLimiter {
+	l := &switchableLimiter{}
+	l.current.Store(rateLimiterHolder{&limiter.DummyRateLimiter{}})
+	return l
+}
+
+func (l *switchableLimiter) load() limiter.RateLimiter {
+	return l.current.Load().(rateLimiterHolder).RateLimiter
+}
+
+// Acquire implements limiter.RateLimiter.
+func (l *switchableLimiter) Acquire(ctx context.Context) bool {
+	return l.load().Acquire(ctx)
+}
+
+// Status implements limiter.RateLimiter.
+func (l *switchableLimiter) Status(ctx context.Context) (max, current int, interval time.Duration) {
+	return l.load().Status(ctx)
+}
+
+// currentAlgorithm returns the algorithm in use.
+func (l *switchableLimiter) currentAlgorithm() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.algorithm
+}
+
+// update updates the limiter in place when the algorithm is not changed, or switches to the limiter
+// of the new algorithm, which starts with the remaining quota of the old one.
+func (l *switchableLimiter) update(algorithm string, qpsLimit, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.load()
+	if algorithm == l.algorithm {
+		if l.updateInPlace(old, qpsLimit, burst) {
+			l.qpsLimit, l.burst = qpsLimit, burst
+			return
+		}
+	}
+	next := l.build(algorithm, qpsLimit, burst)
+	if a, ok := next.(available); ok {
+		if _, dummy := old.(*limiter.DummyRateLimiter); !dummy {
+			_, current, interval := old.Status(context.Background())
+			if interval > 0 && interval < time.Second {
+				// scale the remaining quota of the interval to one second
+				current = int(int64(current) * int64(time.Second) / int64(interval))
+			}
+			if current >= 0 {
+				a.setAvailable(current)
+			}
+		}
+	}
+	l.algorithm, l.qpsLimit, l.burst = algorithm, qpsLimit, burst
+	l.current.Store(rateLimiterHolder{next})
+}
+
+func (l *switchableLimiter) updateInPlace(old limiter.RateLimiter, qpsLimit, burst int) bool {
+	if qpsLimit <= 0 {
+		return false
+	}
+	switch lim := old.(type) {
+	case *tokenBucketLimiter:
+		lim.SetLimit(float64(qpsLimit), burst)
+		atomic.StoreInt64(&lim.limit, int64(qpsLimit))
+		return true
+	case *slidingWindowLimiter:
+		lim.UpdateLimit(qpsLimit)
+		return true
+	case *limiter.DummyRateLimiter:
+		return l.algorithm == LimiterAlgorithmConcurrency
+	case limiter.Updatable:
+		if burst != l.burst {
+			return false
+		}
+		lim.UpdateLimit(qpsLimit)
+		return true
+	}
+	return false
+}
+
+func (l *switchableLimiter) build(algorithm string, qpsLimit, burst int) limiter.RateLimiter {
+	switch algorithm {
+	case LimiterAlgorithmDefault:
+		if qpsLimit <= 0 {
+			return &limiter.DummyRateLimiter{}
+		}
+		// kitex can not stop the ticker of its QPS limiter, so it's reused
+		if l.builtin == nil {
+			l.builtin = limiter.NewQPSLimiter(100*time.Millisecond, qpsLimit)
+		} else {
+			l.builtin.(limiter.Updatable).UpdateLimit(qpsLimit)
+		}
+		return l.builtin
+	case LimiterAlgorithmTokenBucket:
+		if qpsLimit <= 0 {
+			return &limiter.DummyRateLimiter{}
+		}
+		return &tokenBucketLimiter{TokenBucket: utils.NewTokenBucket(float64(qpsLimit), burst), limit: int64(qpsLimit)}
+	case LimiterAlgorithmSlidingWindow:
+		if qpsLimit <= 0 {
+			return &limiter.DummyRateLimiter{}
+		}
+		return newSlidingWindowLimiter(qpsLimit)
+	case LimiterAlgorithmConcurrency:
+		return &limiter.DummyRateLimiter{}
+	}
+	if f, ok := getRateLimiter(algorithm); ok {
+		return f(qpsLimit, burst)
+	}
+	return &limiter.DummyRateLimiter{}
+}
+
+// tokenBucketLimiter the token bucket algorithm.
+type tokenBucketLimiter struct {
+	*utils.TokenBucket
+	limit int64
+}
+
+// Acquire implements limiter.RateLimiter.
+func (l *tokenBucketLimiter) Acquire(ctx context.Context) bool {
+	return l.Allow()
+}
+
+// Status implements limiter.RateLimiter, current is the remaining tokens.
+func (l *tokenBucketLimiter) Status(ctx context.Context) (max, current int, interval time.Duration) {
+	return int(atomic.LoadInt64(&l.limit)), int(l.Tokens()), time.Second
+}
+
+func (l *tokenBucketLimiter) setAvailable(n int) {
+	l.SetTokens(float64(n))
+}
+
+const slidingWindowSlots = 10
+
+// slidingWindowLimiter the sliding window algorithm, the window of one second is divided into slots.
+type slidingWindowLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	counts [slidingWindowSlots]int
+	total  int
+	slot   int64 // the index of the current slot since the epoch
+}
+
+func newSlidingWindowLimiter(limit int) *slidingWindowLimiter {
+	return &slidingWindowLimiter{limit: limit, slot: slotOf(time.Now())}
+}
+
+func slotOf(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Second/slidingWindowSlots)
+}
+
+// advance clears the slots out of the window.
+func (l *slidingWindowLimiter) advance(now time.Time) {
+	slot := slotOf(now)
+	for s := l.slot + 1; s <= slot && s <= l.slot+slidingWindowSlots; s++ {
+		i := s % slidingWindowSlots
+		l.total -= l.counts[i]
+		l.counts[i] = 0
+	}
+	if slot > l.slot {
+		l.slot = slot
+	}
+}
+
+// Acquire implements limiter.RateLimiter.
+func (l *slidingWindowLimiter) Acquire(ctx context.Context) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	if l.total >= l.limit {
+		return false
+	}
+	l.counts[l.slot%slidingWindowSlots]++
+	l.total++
+	return true
+}
+
+// Status implements limiter.RateLimiter, current is the remaining quota of the window.
+func (l *slidingWindowLimiter) Status(ctx context.Context) (max, current int, interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	return l.limit, l.limit - l.total, time.Second
+}
+
+// UpdateLimit implements limiter.Updatable.
+func (l *slidingWindowLimiter) UpdateLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
+// setAvailable accounts the used quota to the current slot.
+func (l *slidingWindowLimiter) setAvailable(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if used := l.limit - n; used > 0 {
+		l.counts[l.slot%slidingWindowSlots] += used
+		l.total += used
+	}
+}
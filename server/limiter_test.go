@@ -0,0 +1,194 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/limiter"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+func newTestLimiters(t *testing.T, cli *apollotest.Client, algorithms bool) *serverLimiters {
+	_, sl, err := initLimitOptions(apollo.ConfigParam{Key: apollo.LimiterConfigName, Type: apollo.JSON},
+		"svc", cli, apollo.GetUniqueID(), algorithms)
+	assert.Equal(t, err, nil)
+	return sl
+}
+
+func newCallCtx(method string) context.Context {
+	ri := rpcinfo.NewRPCInfo(rpcinfo.NewEndpointInfo("cli", "", nil, nil),
+		rpcinfo.NewEndpointInfo("svc", method, nil, nil), rpcinfo.NewInvocation("svc", method), nil, nil)
+	return rpcinfo.NewCtxWithRPCInfo(context.Background(), ri)
+}
+
+func callMethod(ep endpoint.Endpoint, method string) error {
+	return ep(newCallCtx(method), nil, nil)
+}
+
+func noopEndpoint(ctx context.Context, req, resp interface{}) error {
+	return nil
+}
+
+func TestLimiterMethodBuckets(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LimiterConfigName, `{"methods": {"echo": {"qps_limit": 1, "burst": 2}}}`)
+	ep := newTestLimiters(t, cli, true).middleware(noopEndpoint)
+
+	assert.Equal(t, callMethod(ep, "echo"), nil)
+	assert.Equal(t, callMethod(ep, "echo"), nil)
+	assert.Equal(t, errors.Is(callMethod(ep, "echo"), kerrors.ErrQPSOverLimit), true)
+
+	// the methods without limit are not affected
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, callMethod(ep, "other"), nil)
+	}
+}
+
+func TestLimiterMethodBucketsKeptOnUpdate(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LimiterConfigName, `{"methods": {"echo": {"qps_limit": 1, "burst": 1}}}`)
+	sl := newTestLimiters(t, cli, true)
+	ep := sl.middleware(noopEndpoint)
+	bucket := sl.buckets.Load().(map[string]*utils.TokenBucket)["echo"]
+
+	assert.Equal(t, callMethod(ep, "echo"), nil)
+	assert.Equal(t, errors.Is(callMethod(ep, "echo"), kerrors.ErrQPSOverLimit), true)
+
+	// the drained bucket is kept, so it's not refilled by the update
+	cli.Change(apollo.LimiterConfigName, `{"qps_limit": 100, "methods": {"echo": {"qps_limit": 1, "burst": 5}}}`)
+	assert.Equal(t, sl.buckets.Load().(map[string]*utils.TokenBucket)["echo"], bucket)
+	assert.Equal(t, errors.Is(callMethod(ep, "echo"), kerrors.ErrQPSOverLimit), true)
+
+	// the invalid method config is dropped with its bucket
+	cli.Change(apollo.LimiterConfigName, `{"methods": {"echo": {"qps_limit": 1, "burst": -1}}}`)
+	assert.Equal(t, len(sl.buckets.Load().(map[string]*utils.TokenBucket)), 0)
+	assert.Equal(t, callMethod(ep, "echo"), nil)
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	l := newSlidingWindowLimiter(3)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, l.Acquire(context.Background()), true)
+	}
+	assert.Equal(t, l.Acquire(context.Background()), false)
+	_, current, _ := l.Status(context.Background())
+	assert.Equal(t, current, 0)
+
+	// the quota is available again when the window slides by
+	l.mu.Lock()
+	l.advance(time.Now().Add(time.Second))
+	l.mu.Unlock()
+	assert.Equal(t, l.Acquire(context.Background()), true)
+
+	l.UpdateLimit(5)
+	_, current, _ = l.Status(context.Background())
+	assert.Equal(t, current, 4)
+}
+
+func TestLimiterSwitchAlgorithm(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "token_bucket", "qps_limit": 1, "burst": 1}`)
+	sl := newTestLimiters(t, cli, true)
+	_, ok := sl.qps.load().(*tokenBucketLimiter)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, sl.qps.Acquire(context.Background()), true)
+	assert.Equal(t, sl.qps.Acquire(context.Background()), false)
+
+	// the new limiter starts with the remaining quota of the old one
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "sliding_window", "qps_limit": 1}`)
+	_, ok = sl.qps.load().(*slidingWindowLimiter)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, sl.qps.Acquire(context.Background()), false)
+
+	// and it's updated in place when the algorithm is not changed
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "sliding_window", "qps_limit": 3}`)
+	assert.Equal(t, sl.qps.Acquire(context.Background()), true)
+	assert.Equal(t, sl.qps.Acquire(context.Background()), true)
+	assert.Equal(t, sl.qps.Acquire(context.Background()), false)
+
+	// the unregistered algorithm is skipped
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "unknown", "qps_limit": 3}`)
+	assert.Equal(t, sl.qps.currentAlgorithm(), LimiterAlgorithmSlidingWindow)
+}
+
+func TestLimiterBuiltin(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "token_bucket", "qps_limit": 1, "concurrency_limit": 1}`)
+	sl := newTestLimiters(t, cli, false)
+	// the built-in limiter of kitex is used and the algorithm is ignored unless enabled
+	assert.Equal(t, sl.qps, nil)
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "concurrency", "concurrency_limit": 1}`)
+	assert.Equal(t, atomic.LoadInt64(&sl.concurrency), int64(0))
+}
+
+func TestLimiterSwitchFromDefault(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LimiterConfigName, `{"qps_limit": 1}`)
+	sl := newTestLimiters(t, cli, true)
+	// the limiter is installed even if the server starts with the default algorithm
+	assert.Equal(t, sl.qps.currentAlgorithm(), LimiterAlgorithmDefault)
+	_, ok := sl.qps.load().(*limiter.DummyRateLimiter)
+	assert.Equal(t, ok, false)
+
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "token_bucket", "qps_limit": 1}`)
+	assert.Equal(t, sl.qps.currentAlgorithm(), LimiterAlgorithmTokenBucket)
+	_, ok = sl.qps.load().(*tokenBucketLimiter)
+	assert.Equal(t, ok, true)
+
+	cli.Change(apollo.LimiterConfigName, `{"qps_limit": 1}`)
+	assert.Equal(t, sl.qps.currentAlgorithm(), LimiterAlgorithmDefault)
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "token_bucket", "qps_limit": 100}`)
+	sl := newTestLimiters(t, cli, true)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	ep := sl.middleware(func(ctx context.Context, req, resp interface{}) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	done := make(chan error)
+	go func() { done <- callMethod(ep, "echo") }()
+	<-started
+
+	// the requests in flight are counted when switched to the concurrency algorithm
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "concurrency", "concurrency_limit": 1}`)
+	err := callMethod(ep, "echo")
+	assert.Equal(t, errors.Is(err, kerrors.ErrOverlimit), true)
+
+	close(release)
+	assert.Equal(t, <-done, nil)
+	go func() { <-started }()
+	assert.Equal(t, callMethod(ep, "echo"), nil)
+
+	// no limit after switched back
+	cli.Change(apollo.LimiterConfigName, `{"algorithm": "token_bucket", "qps_limit": 100, "concurrency_limit": 1}`)
+	assert.Equal(t, atomic.LoadInt64(&sl.concurrency), int64(0))
+}
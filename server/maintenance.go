@@ -0,0 +1,180 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/server"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+const (
+	defaultMaintenanceCode    = 503
+	defaultMaintenanceMessage = "service under maintenance"
+)
+
+// MaintenanceConfig puts the methods or the whole service into maintenance.
+type MaintenanceConfig struct {
+	Enabled bool `json:"enabled"`
+	// Methods the methods under maintenance, the whole service if it's empty.
+	Methods []string `json:"methods"`
+	// AllowCallers the caller service names still served in maintenance.
+	AllowCallers []string `json:"allow_callers"`
+	// ErrorCode the code of the biz status error returned, 503 by default.
+	ErrorCode int32 `json:"error_code"`
+	// Message the message of the biz status error returned.
+	Message string `json:"message"`
+	// StartTime the maintenance starts at, in RFC 3339, immediately if it's not set.
+	StartTime time.Time `json:"start_time"`
+	// EndTime the maintenance ends at, in RFC 3339, never if it's not set.
+	EndTime time.Time `json:"end_time"`
+}
+
+// Validate checks the config.
+func (c *MaintenanceConfig) Validate() error {
+	if !c.StartTime.IsZero() && !c.EndTime.IsZero() && !c.EndTime.After(c.StartTime) {
+		return fmt.Errorf("end_time %s is not after start_time %s", c.EndTime, c.StartTime)
+	}
+	return nil
+}
+
+// maintenance the compiled MaintenanceConfig.
+type maintenance struct {
+	enabled bool
+	methods utils.Set
+	callers utils.Set
+	start   time.Time
+	end     time.Time
+	err     error
+}
+
+func newMaintenance(c *MaintenanceConfig) *maintenance {
+	m := &maintenance{enabled: c.Enabled, start: c.StartTime, end: c.EndTime, callers: utils.Set{}}
+	if len(c.Methods) > 0 {
+		m.methods = utils.Set{}
+		for _, method := range c.Methods {
+			m.methods[method] = true
+		}
+	}
+	for _, caller := range c.AllowCallers {
+		m.callers[caller] = true
+	}
+	code, msg := c.ErrorCode, c.Message
+	if code == 0 {
+		code = defaultMaintenanceCode
+	}
+	if msg == "" {
+		msg = defaultMaintenanceMessage
+	}
+	m.err = kerrors.NewBizStatusError(code, msg)
+	return m
+}
+
+// active reports whether the maintenance is in effect at now.
+func (m *maintenance) active(now time.Time) bool {
+	if !m.enabled {
+		return false
+	}
+	if !m.start.IsZero() && now.Before(m.start) {
+		return false
+	}
+	return m.end.IsZero() || now.Before(m.end)
+}
+
+// WithMaintenance rejects the requests in maintenance by the config from apollo configuration center.
+// It panics when failed, use WithMaintenanceE to handle the error.
+func WithMaintenance(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) server.Option {
+	option, err := WithMaintenanceE(dest, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return option
+}
+
+// WithMaintenanceE rejects the requests in maintenance by the config from apollo configuration center.
+func WithMaintenanceE(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) (server.Option, error) {
+	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.MaintenanceConfigName,
+		ServerServiceName: dest,
+	})
+	if err != nil {
+		return server.Option{}, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	uniqueID := apollo.GetUniqueID()
+	var current atomic.Value // *maintenance
+	current.Store(&maintenance{})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		cfg := &MaintenanceConfig{}
+		err := parser.Decode(param.Type, data, cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s server apollo maintenance: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			klog.Warnf("[apollo] %s server maintenance config is invalid: %s, skip...", dest, err)
+			return err
+		}
+		current.Store(newMaintenance(cfg))
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return server.Option{}, err
+	}
+	server.RegisterShutdownHook(func() {
+		apolloClient.DeregisterConfig(param, uniqueID)
+	})
+	return server.WithMiddleware(maintenanceMiddleware(&current)), nil
+}
+
+func maintenanceMiddleware(current *atomic.Value) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			m := current.Load().(*maintenance)
+			if !m.active(time.Now()) {
+				return next(ctx, req, resp)
+			}
+			ri := rpcinfo.GetRPCInfo(ctx)
+			if ri == nil {
+				return next(ctx, req, resp)
+			}
+			if m.methods != nil && !m.methods[ri.To().Method()] {
+				return next(ctx, req, resp)
+			}
+			if from := ri.From(); from != nil && m.callers[from.ServiceName()] {
+				return next(ctx, req, resp)
+			}
+			return reject(ri, m.err)
+		}
+	}
+}
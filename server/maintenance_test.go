@@ -0,0 +1,97 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex-examples/kitex_gen/api"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+func TestMaintenanceBizStatusError(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.MaintenanceConfigName, `{"enabled": true}`)
+	option, err := WithMaintenanceE("svc", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+	echoCli := runEchoServer(t, option)
+
+	_, err = echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	bizErr, ok := kerrors.FromBizStatusError(err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, bizErr.BizStatusCode(), int32(defaultMaintenanceCode))
+	assert.Equal(t, bizErr.BizMessage(), defaultMaintenanceMessage)
+
+	cli.Change(apollo.MaintenanceConfigName, `{"enabled": true, "error_code": 1002, "message": "upgrading"}`)
+	_, err = echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	bizErr, ok = kerrors.FromBizStatusError(err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, bizErr.BizStatusCode(), int32(1002))
+	assert.Equal(t, bizErr.BizMessage(), "upgrading")
+
+	// the allowed callers and the methods not under maintenance are served
+	cli.Change(apollo.MaintenanceConfigName, `{"enabled": true, "allow_callers": ["cli"]}`)
+	resp, err := echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.Message, "hello")
+
+	cli.Change(apollo.MaintenanceConfigName, `{"enabled": true, "methods": ["other"]}`)
+	resp, err = echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.Message, "hello")
+}
+
+func TestMaintenanceActive(t *testing.T) {
+	start := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	cases := []struct {
+		name   string
+		config MaintenanceConfig
+		now    time.Time
+		active bool
+	}{
+		{"disabled", MaintenanceConfig{StartTime: start, EndTime: end}, start, false},
+		{"no window", MaintenanceConfig{Enabled: true}, start, true},
+		{"before window", MaintenanceConfig{Enabled: true, StartTime: start, EndTime: end}, start.Add(-time.Second), false},
+		{"window starts", MaintenanceConfig{Enabled: true, StartTime: start, EndTime: end}, start, true},
+		{"in window", MaintenanceConfig{Enabled: true, StartTime: start, EndTime: end}, start.Add(time.Minute), true},
+		{"window ends", MaintenanceConfig{Enabled: true, StartTime: start, EndTime: end}, end, false},
+		{"after window", MaintenanceConfig{Enabled: true, StartTime: start, EndTime: end}, end.Add(time.Second), false},
+		{"before start only", MaintenanceConfig{Enabled: true, StartTime: start}, start.Add(-time.Second), false},
+		{"after start only", MaintenanceConfig{Enabled: true, StartTime: start}, end.Add(24 * time.Hour), true},
+		{"before end only", MaintenanceConfig{Enabled: true, EndTime: end}, start.Add(-24 * time.Hour), true},
+		{"after end only", MaintenanceConfig{Enabled: true, EndTime: end}, end.Add(time.Second), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, newMaintenance(&tc.config).active(tc.now), tc.active)
+		})
+	}
+}
+
+func TestMaintenanceValidate(t *testing.T) {
+	start := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, (&MaintenanceConfig{StartTime: start, EndTime: start.Add(time.Hour)}).Validate(), nil)
+	assert.Equal(t, (&MaintenanceConfig{StartTime: start}).Validate(), nil)
+	assert.NotEqual(t, (&MaintenanceConfig{StartTime: start, EndTime: start}).Validate(), nil)
+	assert.NotEqual(t, (&MaintenanceConfig{StartTime: start, EndTime: start.Add(-time.Hour)}).Validate(), nil)
+}
@@ -0,0 +1,346 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/server"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// ErrOverloaded is the cause of the kerrors.ErrOverlimit returned when a request is shed.
+var ErrOverloaded = errors.New("server overloaded")
+
+const (
+	defaultCPUThreshold  = 80
+	defaultOverloadWinMS = 10000
+	defaultOverloadSlots = 100
+	// keep shedding for a while after the last drop even if the cpu usage falls below the threshold,
+	// so the load does not swing
+	overloadCoolDown = time.Second
+)
+
+// OverloadConfig the adaptive overload protection config, which sheds the requests when the cpu usage
+// is over the threshold and the in-flight requests are over the capacity estimated by the max pass rate
+// and the min latency of the window, as the BBR algorithm does.
+type OverloadConfig struct {
+	Enabled bool `json:"enabled"`
+	// CPUThreshold the cpu usage percentage of the process over GOMAXPROCS to start shedding, 80 by default.
+	CPUThreshold float64 `json:"cpu_threshold"`
+	// WindowMS the window to estimate the capacity, 10000 by default.
+	WindowMS int64 `json:"window_ms"`
+	// Buckets the number of the buckets of the window, 100 by default.
+	Buckets int `json:"buckets"`
+	// Priorities the priority of the methods, 0 by default. The requests of the lower priorities are shed
+	// first, the priority p could use (p+1)/(max+1) of the capacity, where max is the highest priority.
+	Priorities map[string]int `json:"priorities"`
+}
+
+// Validate checks the config.
+func (c *OverloadConfig) Validate() error {
+	if c.CPUThreshold < 0 || c.CPUThreshold > 100 {
+		return fmt.Errorf("cpu_threshold %v is out of [0, 100]", c.CPUThreshold)
+	}
+	if c.WindowMS < 0 || c.Buckets < 0 {
+		return fmt.Errorf("window_ms and buckets must not be negative")
+	}
+	for method, p := range c.Priorities {
+		if p < 0 {
+			return fmt.Errorf("priority of method %s must not be negative", method)
+		}
+	}
+	return nil
+}
+
+func (c *OverloadConfig) setDefaults() {
+	if c.CPUThreshold == 0 {
+		c.CPUThreshold = defaultCPUThreshold
+	}
+	if c.WindowMS == 0 {
+		c.WindowMS = defaultOverloadWinMS
+	}
+	if c.Buckets == 0 {
+		c.Buckets = defaultOverloadSlots
+	}
+}
+
+func (c *OverloadConfig) maxPriority() int {
+	max := 0
+	for _, p := range c.Priorities {
+		if p > max {
+			max = p
+		}
+	}
+	return max
+}
+
+// WithOverloadProtection sheds the requests adaptively by the config from apollo configuration center.
+// It panics when failed, use WithOverloadProtectionE to handle the error.
+func WithOverloadProtection(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) server.Option {
+	option, err := WithOverloadProtectionE(dest, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return option
+}
+
+// WithOverloadProtectionE sheds the requests adaptively by the config from apollo configuration center.
+func WithOverloadProtectionE(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) (server.Option, error) {
+	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.OverloadConfigName,
+		ServerServiceName: dest,
+	})
+	if err != nil {
+		return server.Option{}, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	uniqueID := apollo.GetUniqueID()
+	o, err := initOverloadProtection(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return server.Option{}, err
+	}
+	server.RegisterShutdownHook(func() {
+		apolloClient.DeregisterConfig(param, uniqueID)
+		o.cpu.stop()
+	})
+	return server.WithMiddleware(o.middleware), nil
+}
+
+// overloadState the window and the config, replaced as a whole when the config changes.
+type overloadState struct {
+	config      *OverloadConfig
+	maxPriority int
+	window      *passWindow
+}
+
+type overloadProtection struct {
+	state    atomic.Value // *overloadState
+	cpu      *cpuSampler
+	inflight int64
+	prevDrop int64 // unix nano of the last drop
+}
+
+func (o *overloadProtection) middleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, req, resp interface{}) error {
+		st := o.state.Load().(*overloadState)
+		if !st.config.Enabled {
+			return next(ctx, req, resp)
+		}
+		var method string
+		if ri := rpcinfo.GetRPCInfo(ctx); ri != nil {
+			method = ri.To().Method()
+		}
+		inflight := atomic.AddInt64(&o.inflight, 1)
+		defer atomic.AddInt64(&o.inflight, -1)
+		if o.shouldDrop(st, method, inflight) {
+			return kerrors.ErrOverlimit.WithCause(ErrOverloaded)
+		}
+		start := time.Now()
+		err := next(ctx, req, resp)
+		st.window.add(time.Since(start))
+		return err
+	}
+}
+
+func (o *overloadProtection) shouldDrop(st *overloadState, method string, inflight int64) bool {
+	now := time.Now().UnixNano()
+	if o.cpu.usage() < st.config.CPUThreshold {
+		prev := atomic.LoadInt64(&o.prevDrop)
+		if prev == 0 {
+			return false
+		}
+		if time.Duration(now-prev) > overloadCoolDown {
+			atomic.CompareAndSwapInt64(&o.prevDrop, prev, 0)
+			return false
+		}
+	}
+	maxFlight := st.window.maxFlight()
+	if maxFlight <= 0 {
+		return false
+	}
+	p := st.config.Priorities[method]
+	limit := maxFlight * float64(p+1) / float64(st.maxPriority+1)
+	if float64(inflight) <= math.Max(limit, 1) {
+		return false
+	}
+	atomic.StoreInt64(&o.prevDrop, now)
+	return true
+}
+
+func initOverloadProtection(param apollo.ConfigParam, dest string, apolloClient apollo.Client, uniqueID int64,
+) (*overloadProtection, error) {
+	o := &overloadProtection{cpu: newCPUSampler()}
+	o.state.Store(&overloadState{config: &OverloadConfig{}})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		cfg := &OverloadConfig{}
+		err := parser.Decode(param.Type, data, cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s server apollo overload: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			klog.Warnf("[apollo] %s server overload config is invalid: %s, skip...", dest, err)
+			return err
+		}
+		cfg.setDefaults()
+		old := o.state.Load().(*overloadState)
+		window := old.window
+		bucket := time.Duration(cfg.WindowMS) * time.Millisecond / time.Duration(cfg.Buckets)
+		if window == nil || window.bucket != bucket || len(window.buckets) != cfg.Buckets {
+			window = newPassWindow(bucket, cfg.Buckets)
+		}
+		o.state.Store(&overloadState{config: cfg, maxPriority: cfg.maxPriority(), window: window})
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		o.cpu.stop()
+		return nil, err
+	}
+	return o, nil
+}
+
+type passBucket struct {
+	pass int64
+	rt   time.Duration
+}
+
+// passWindow the rolling window of the completed requests and their latency.
+type passWindow struct {
+	mu      sync.Mutex
+	bucket  time.Duration
+	buckets []passBucket
+	cur     int64 // the index of the current bucket since the epoch
+}
+
+func newPassWindow(bucket time.Duration, size int) *passWindow {
+	if bucket <= 0 {
+		bucket = time.Millisecond
+	}
+	return &passWindow{bucket: bucket, buckets: make([]passBucket, size), cur: time.Now().UnixNano() / int64(bucket)}
+}
+
+// advance clears the buckets out of the window, it must be called with the lock held.
+func (w *passWindow) advance() {
+	cur := time.Now().UnixNano() / int64(w.bucket)
+	size := int64(len(w.buckets))
+	for i := w.cur + 1; i <= cur && i <= w.cur+size; i++ {
+		w.buckets[i%size] = passBucket{}
+	}
+	if cur > w.cur {
+		w.cur = cur
+	}
+}
+
+func (w *passWindow) add(rt time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.advance()
+	b := &w.buckets[w.cur%int64(len(w.buckets))]
+	b.pass++
+	b.rt += rt
+}
+
+// maxFlight estimates the capacity by the max pass of a bucket and the min average latency of the buckets,
+// the current bucket is excluded as it's not complete. It returns 0 if there are no samples yet.
+func (w *passWindow) maxFlight() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.advance()
+	size := int64(len(w.buckets))
+	var maxPass int64
+	minRT := time.Duration(math.MaxInt64)
+	for i, b := range w.buckets {
+		if int64(i) == w.cur%size || b.pass == 0 {
+			continue
+		}
+		if b.pass > maxPass {
+			maxPass = b.pass
+		}
+		if rt := b.rt / time.Duration(b.pass); rt < minRT {
+			minRT = rt
+		}
+	}
+	if maxPass == 0 {
+		return 0
+	}
+	return float64(maxPass) * float64(minRT) / float64(w.bucket)
+}
+
+const cpuSampleInterval = 250 * time.Millisecond
+
+// cpuSampler samples the cpu usage of the process with a moving average.
+type cpuSampler struct {
+	usageBits uint64 // float64 bits of the usage percentage
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newCPUSampler() *cpuSampler {
+	s := &cpuSampler{done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *cpuSampler) usage() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.usageBits))
+}
+
+func (s *cpuSampler) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+func (s *cpuSampler) run() {
+	ticker := time.NewTicker(cpuSampleInterval)
+	defer ticker.Stop()
+	lastCPU, lastTime := processCPUTime(), time.Now()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			cpu := processCPUTime()
+			elapsed := now.Sub(lastTime) * time.Duration(runtime.GOMAXPROCS(0))
+			if elapsed > 0 {
+				cur := math.Min(100, float64(cpu-lastCPU)/float64(elapsed)*100)
+				// decay the previous usage so a spike does not trigger the shedding alone
+				usage := s.usage()*0.8 + cur*0.2
+				atomic.StoreUint64(&s.usageBits, math.Float64bits(usage))
+			}
+			lastCPU, lastTime = cpu, now
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+)
+
+// newTestOverload creates the overload protection with a fixed cpu usage.
+func newTestOverload(t *testing.T, cli *apollotest.Client, usage float64) *overloadProtection {
+	o, err := initOverloadProtection(apollo.ConfigParam{Key: apollo.OverloadConfigName, Type: apollo.JSON},
+		"svc", cli, apollo.GetUniqueID())
+	assert.Equal(t, err, nil)
+	o.cpu.stop()
+	o.cpu = &cpuSampler{done: make(chan struct{})}
+	atomic.StoreUint64(&o.cpu.usageBits, math.Float64bits(usage))
+	return o
+}
+
+// fillWindow records the passed requests to the complete bucket before the current one.
+func fillWindow(o *overloadProtection, pass int64, rt time.Duration) {
+	w := o.state.Load().(*overloadState).window
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.advance()
+	w.buckets[(w.cur-1)%int64(len(w.buckets))] = passBucket{pass: pass, rt: time.Duration(pass) * rt}
+}
+
+func TestOverloadShedding(t *testing.T) {
+	cli := apollotest.NewClient()
+	// the capacity is 400 * 10ms / 1s = 4
+	cli.Change(apollo.OverloadConfigName, `{"enabled": true, "window_ms": 10000, "buckets": 10}`)
+	o := newTestOverload(t, cli, 100)
+	fillWindow(o, 400, 10*time.Millisecond)
+	st := o.state.Load().(*overloadState)
+	assert.Equal(t, st.window.maxFlight(), float64(4))
+
+	assert.Equal(t, o.shouldDrop(st, "echo", 4), false)
+	assert.Equal(t, o.shouldDrop(st, "echo", 5), true)
+
+	// the requests over the capacity are shed by the middleware
+	atomic.StoreInt64(&o.inflight, 4)
+	err := o.middleware(noopEndpoint)(context.Background(), nil, nil)
+	assert.Equal(t, errors.Is(err, kerrors.ErrOverlimit), true)
+	assert.Equal(t, errors.Is(err, ErrOverloaded), true)
+	assert.Equal(t, atomic.LoadInt64(&o.inflight), int64(4))
+}
+
+func TestOverloadBelowThreshold(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.OverloadConfigName, `{"enabled": true, "cpu_threshold": 50, "window_ms": 10000, "buckets": 10}`)
+	o := newTestOverload(t, cli, 10)
+	fillWindow(o, 400, 10*time.Millisecond)
+	st := o.state.Load().(*overloadState)
+	assert.Equal(t, o.shouldDrop(st, "echo", 100), false)
+
+	// keep shedding in the cool down after the last drop
+	atomic.StoreInt64(&o.prevDrop, time.Now().UnixNano())
+	assert.Equal(t, o.shouldDrop(st, "echo", 100), true)
+	atomic.StoreInt64(&o.prevDrop, time.Now().Add(-2*overloadCoolDown).UnixNano())
+	assert.Equal(t, o.shouldDrop(st, "echo", 100), false)
+	assert.Equal(t, atomic.LoadInt64(&o.prevDrop), int64(0))
+}
+
+func TestOverloadPriorities(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.OverloadConfigName, `{"enabled": true, "window_ms": 10000, "buckets": 10, "priorities": {"important": 1}}`)
+	o := newTestOverload(t, cli, 100)
+	fillWindow(o, 400, 10*time.Millisecond)
+	st := o.state.Load().(*overloadState)
+
+	// the lower priority could use half of the capacity
+	assert.Equal(t, o.shouldDrop(st, "echo", 3), true)
+	assert.Equal(t, o.shouldDrop(st, "important", 3), false)
+	assert.Equal(t, o.shouldDrop(st, "important", 5), true)
+}
+
+func TestOverloadDisabled(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.OverloadConfigName, `{"enabled": false}`)
+	o := newTestOverload(t, cli, 100)
+	atomic.StoreInt64(&o.inflight, 1000)
+	assert.Equal(t, o.middleware(noopEndpoint)(context.Background(), nil, nil), nil)
+}
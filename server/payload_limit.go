@@ -0,0 +1,134 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/server"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// WithPayloadLimit rejects the requests and the responses over the size limits by the config from
+// apollo configuration center.
+// It panics when failed, use WithPayloadLimitE to handle the error.
+func WithPayloadLimit(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) server.Option {
+	option, err := WithPayloadLimitE(dest, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return option
+}
+
+// WithPayloadLimitE rejects the requests and the responses over the size limits by the config from
+// apollo configuration center.
+func WithPayloadLimitE(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) (server.Option, error) {
+	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.PayloadLimitConfigName,
+		ServerServiceName: dest,
+	})
+	if err != nil {
+		return server.Option{}, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	uniqueID := apollo.GetUniqueID()
+	container, err := initPayloadLimitContainer(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return server.Option{}, err
+	}
+	server.RegisterShutdownHook(func() {
+		apolloClient.DeregisterConfig(param, uniqueID)
+	})
+	return server.WithMiddleware(payloadLimitMiddleware(container)), nil
+}
+
+// payloadLimitMiddleware checks the request by the size decoded or estimated if the codec does not
+// record it, which is after the request is read, and the response by the size estimated before it's
+// encoded. The request fails if the size is unknown.
+func payloadLimitMiddleware(container *utils.PayloadLimitContainer) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			ri := rpcinfo.GetRPCInfo(ctx)
+			if ri == nil {
+				return next(ctx, req, resp)
+			}
+			method := ri.To().Method()
+			limit := container.Get(method)
+			if limit == nil {
+				return next(ctx, req, resp)
+			}
+			if limit.MaxRequestBytes > 0 {
+				size := int64(ri.Stats().RecvSize())
+				if size == 0 {
+					size = utils.PayloadSize(req)
+				}
+				if err := limit.CheckRequest(method, size); err != nil {
+					return err
+				}
+			}
+			if err := next(ctx, req, resp); err != nil {
+				return err
+			}
+			if limit.MaxResponseBytes > 0 {
+				return limit.CheckResponse(method, utils.PayloadSize(resp))
+			}
+			return nil
+		}
+	}
+}
+
+func initPayloadLimitContainer(param apollo.ConfigParam, dest string,
+	apolloClient apollo.Client, uniqueID int64,
+) (*utils.PayloadLimitContainer, error) {
+	container := utils.NewPayloadLimitContainer()
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		configs := map[string]*utils.PayloadLimitConfig{}
+		err := parser.Decode(param.Type, data, &configs)
+		if err != nil {
+			klog.Warnf("[apollo] %s server apollo payload limit: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		for method, cfg := range configs {
+			if cfg == nil {
+				delete(configs, method)
+				continue
+			}
+			if err := cfg.Validate(); err != nil {
+				klog.Warnf("[apollo] %s server payload limit for method %s is invalid: %s, skip...", dest, method, err)
+				apolloClient.MetricsHook().ValidationRejected(apollo.PayloadLimitConfigName)
+				delete(configs, method)
+			}
+		}
+		container.NotifyPolicyChange(configs)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
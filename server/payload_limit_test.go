@@ -0,0 +1,67 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/kitex-examples/kitex_gen/api"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+func TestPayloadLimitRequest(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.PayloadLimitConfigName, `{"echo": {"max_request_bytes": 256}}`)
+	option, err := WithPayloadLimitE("svc", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+	echoCli := runEchoServer(t, option)
+
+	resp, err := echoCli.Echo(context.Background(), &api.Request{Message: "hello"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.Message, "hello")
+
+	_, err = echoCli.Echo(context.Background(), &api.Request{Message: strings.Repeat("x", 512)})
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, strings.Contains(err.Error(), utils.ErrPayloadTooLarge.Error()), true)
+}
+
+func TestPayloadLimitUnknownSize(t *testing.T) {
+	container := utils.NewPayloadLimitContainer()
+	container.NotifyPolicyChange(map[string]*utils.PayloadLimitConfig{
+		"echo": {MaxRequestBytes: 64, MaxResponseBytes: 64},
+	})
+	ep := payloadLimitMiddleware(container)(noopEndpoint)
+	ri := rpcinfo.NewRPCInfo(rpcinfo.NewEndpointInfo("cli", "", nil, nil),
+		rpcinfo.NewEndpointInfo("svc", "echo", nil, nil), rpcinfo.NewInvocation("svc", "echo"),
+		nil, rpcinfo.NewRPCStats())
+	ctx := rpcinfo.NewCtxWithRPCInfo(context.Background(), ri)
+
+	// the codec does not record the size and the request provides no way to estimate it
+	err := ep(ctx, struct{}{}, &api.Response{})
+	assert.Equal(t, errors.Is(err, utils.ErrPayloadSizeUnknown), true)
+
+	err = ep(ctx, &api.Request{Message: "hello"}, struct{}{})
+	assert.Equal(t, errors.Is(err, utils.ErrPayloadSizeUnknown), true)
+
+	assert.Equal(t, ep(ctx, &api.Request{Message: "hello"}, &api.Response{Message: "hello"}), nil)
+}
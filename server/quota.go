@@ -0,0 +1,272 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/cloudwego/kitex/server"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// DefaultQuotaKey the key in the quota document for the callers without explicit config.
+const DefaultQuotaKey = "*"
+
+// MaxDefaultQuotaCallers the max number of the quota states kept for the callers without explicit config,
+// the least recently used one is evicted to make room for a new caller.
+const MaxDefaultQuotaCallers = 1024
+
+// ErrQuotaExceeded is the cause of the kerrors.ErrOverlimit returned when a caller exceeds its quota.
+var ErrQuotaExceeded = errors.New("caller quota exceeded")
+
+// QuotaConfig the quota of a caller, the key is the caller service name.
+type QuotaConfig struct {
+	// QPS the max requests per second of the caller, no limit if it's not positive.
+	QPS float64 `json:"qps"`
+	// Burst the max requests allowed at once, ceil(qps) by default.
+	Burst int `json:"burst"`
+	// Concurrency the max in-flight requests of the caller, no limit if it's not positive.
+	Concurrency int64 `json:"concurrency"`
+}
+
+// Validate checks the config.
+func (c *QuotaConfig) Validate() error {
+	if c.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	return nil
+}
+
+// WithQuota limits the QPS and concurrency of each caller by the config from apollo configuration center.
+// It panics when failed, use WithQuotaE to handle the error.
+func WithQuota(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) server.Option {
+	option, err := WithQuotaE(dest, apolloClient, opts)
+	if err != nil {
+		panic(err)
+	}
+	return option
+}
+
+// WithQuotaE limits the QPS and concurrency of each caller by the config from apollo configuration center.
+func WithQuotaE(dest string, apolloClient apollo.Client,
+	opts utils.Options,
+) (server.Option, error) {
+	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.QuotaConfigName,
+		ServerServiceName: dest,
+	})
+	if err != nil {
+		return server.Option{}, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	uniqueID := apollo.GetUniqueID()
+	q, err := initQuotas(param, dest, apolloClient, uniqueID)
+	if err != nil {
+		return server.Option{}, err
+	}
+	server.RegisterShutdownHook(func() {
+		apolloClient.DeregisterConfig(param, uniqueID)
+	})
+	return server.WithMiddleware(q.middleware), nil
+}
+
+// callerQuota the quota state of a caller, kept across the config changes.
+type callerQuota struct {
+	config   atomic.Value // *QuotaConfig
+	bucket   *utils.TokenBucket
+	inflight int64
+	// lastUsed the unix nano of the last request, to evict the least recently used default state
+	lastUsed int64
+	// explicit whether the caller has explicit config, guarded by quotas.mu
+	explicit bool
+}
+
+func (cq *callerQuota) setConfig(c *QuotaConfig) {
+	cq.config.Store(c)
+	cq.bucket.SetLimit(c.QPS, c.Burst)
+}
+
+// quotas the quota states of the callers. Every caller has its own state, the ones of the callers
+// without explicit config are built from the config of DefaultQuotaKey and bounded by MaxDefaultQuotaCallers.
+type quotas struct {
+	configs atomic.Value // map[string]*QuotaConfig
+
+	mu       sync.Mutex
+	callers  sync.Map // caller -> *callerQuota
+	defaults int      // the number of the states of the callers without explicit config
+}
+
+// quotaConfig returns the config of the caller and whether it's explicit.
+func quotaConfig(configs map[string]*QuotaConfig, caller string) (*QuotaConfig, bool) {
+	if c, ok := configs[caller]; ok {
+		return c, true
+	}
+	return configs[DefaultQuotaKey], false
+}
+
+func (q *quotas) caller(caller string) *callerQuota {
+	now := time.Now().UnixNano()
+	if cq, ok := q.callers.Load(caller); ok {
+		atomic.StoreInt64(&cq.(*callerQuota).lastUsed, now)
+		return cq.(*callerQuota)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if cq, ok := q.callers.Load(caller); ok {
+		atomic.StoreInt64(&cq.(*callerQuota).lastUsed, now)
+		return cq.(*callerQuota)
+	}
+	// load the config under the lock so the state is not created with a replaced config
+	c, explicit := quotaConfig(q.configs.Load().(map[string]*QuotaConfig), caller)
+	if c == nil {
+		return nil
+	}
+	if !explicit {
+		if q.defaults >= MaxDefaultQuotaCallers {
+			q.evict()
+		}
+		q.defaults++
+	}
+	cq := &callerQuota{bucket: utils.NewTokenBucket(c.QPS, c.Burst), lastUsed: now, explicit: explicit}
+	cq.config.Store(c)
+	q.callers.Store(caller, cq)
+	return cq
+}
+
+// evict drops the least recently used state of the callers without explicit config, must be called
+// with mu held. The in-flight requests release the dropped state.
+func (q *quotas) evict() {
+	var (
+		oldest   interface{}
+		lastUsed int64
+	)
+	q.callers.Range(func(key, value interface{}) bool {
+		cq := value.(*callerQuota)
+		if used := atomic.LoadInt64(&cq.lastUsed); !cq.explicit && (oldest == nil || used < lastUsed) {
+			oldest, lastUsed = key, used
+		}
+		return true
+	})
+	if oldest != nil {
+		q.callers.Delete(oldest)
+		q.defaults--
+	}
+}
+
+func (q *quotas) update(configs map[string]*QuotaConfig) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.configs.Store(configs)
+	q.callers.Range(func(key, value interface{}) bool {
+		cq := value.(*callerQuota)
+		// the removed caller falls back to the default config with its own state
+		c, explicit := quotaConfig(configs, key.(string))
+		if c == nil {
+			// the in-flight requests release the removed state
+			q.callers.Delete(key)
+			if !cq.explicit {
+				q.defaults--
+			}
+			return true
+		}
+		if cq.explicit != explicit {
+			cq.explicit = explicit
+			if explicit {
+				q.defaults--
+			} else {
+				q.defaults++
+			}
+		}
+		cq.setConfig(c)
+		return true
+	})
+	for q.defaults > MaxDefaultQuotaCallers {
+		q.evict()
+	}
+}
+
+func (q *quotas) middleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, req, resp interface{}) error {
+		ri := rpcinfo.GetRPCInfo(ctx)
+		if ri == nil || ri.From() == nil {
+			return next(ctx, req, resp)
+		}
+		caller := ri.From().ServiceName()
+		cq := q.caller(caller)
+		if cq == nil {
+			return next(ctx, req, resp)
+		}
+		c := cq.config.Load().(*QuotaConfig)
+		if c.Concurrency > 0 {
+			defer atomic.AddInt64(&cq.inflight, -1)
+			if atomic.AddInt64(&cq.inflight, 1) > c.Concurrency {
+				return kerrors.ErrOverlimit.WithCause(fmt.Errorf("%w: caller %s exceeds the concurrency %d",
+					ErrQuotaExceeded, caller, c.Concurrency))
+			}
+		}
+		if c.QPS > 0 && !cq.bucket.Allow() {
+			return kerrors.ErrOverlimit.WithCause(fmt.Errorf("%w: caller %s exceeds the qps %v",
+				ErrQuotaExceeded, caller, c.QPS))
+		}
+		return next(ctx, req, resp)
+	}
+}
+
+func initQuotas(param apollo.ConfigParam, dest string, apolloClient apollo.Client, uniqueID int64) (*quotas, error) {
+	q := &quotas{}
+	q.configs.Store(map[string]*QuotaConfig{})
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		configs := map[string]*QuotaConfig{}
+		err := parser.Decode(param.Type, data, &configs)
+		if err != nil {
+			klog.Warnf("[apollo] %s server apollo quota: unmarshal data %s failed: %s, skip...", dest, data, err)
+			return err
+		}
+		for caller, c := range configs {
+			if c == nil {
+				delete(configs, caller)
+				continue
+			}
+			if err := c.Validate(); err != nil {
+				klog.Warnf("[apollo] %s server quota for caller %s is invalid: %s, skip...", dest, caller, err)
+				apolloClient.MetricsHook().ValidationRejected(apollo.QuotaConfigName)
+				delete(configs, caller)
+			}
+		}
+		q.update(configs)
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, uniqueID); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+)
+
+func newTestQuotas(t *testing.T, cli *apollotest.Client) *quotas {
+	q, err := initQuotas(apollo.ConfigParam{Key: apollo.QuotaConfigName, Type: apollo.JSON},
+		"svc", cli, apollo.GetUniqueID())
+	assert.Equal(t, err, nil)
+	return q
+}
+
+func callFrom(ep endpoint.Endpoint, caller string) error {
+	ri := rpcinfo.NewRPCInfo(rpcinfo.NewEndpointInfo(caller, "", nil, nil),
+		rpcinfo.NewEndpointInfo("svc", "echo", nil, nil), rpcinfo.NewInvocation("svc", "echo"), nil, nil)
+	return ep(rpcinfo.NewCtxWithRPCInfo(context.Background(), ri), nil, nil)
+}
+
+func countStates(q *quotas) int {
+	n := 0
+	q.callers.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestQuotaCaller(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.QuotaConfigName, `{"a": {"qps": 1, "burst": 1}, "b": {"qps": 1, "burst": 2}}`)
+	ep := newTestQuotas(t, cli).middleware(noopEndpoint)
+
+	assert.Equal(t, callFrom(ep, "a"), nil)
+	assert.Equal(t, errors.Is(callFrom(ep, "a"), ErrQuotaExceeded), true)
+	// each caller with explicit config has its own quota
+	assert.Equal(t, callFrom(ep, "b"), nil)
+	assert.Equal(t, callFrom(ep, "b"), nil)
+	assert.Equal(t, errors.Is(callFrom(ep, "b"), ErrQuotaExceeded), true)
+	// no limit for the callers without config
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, callFrom(ep, "c"), nil)
+	}
+}
+
+func TestQuotaDefaultPerCaller(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.QuotaConfigName, `{"*": {"qps": 0.01, "burst": 1}, "a": {"qps": 0.01, "burst": 1}}`)
+	q := newTestQuotas(t, cli)
+	ep := q.middleware(noopEndpoint)
+
+	// each caller without explicit config has its own quota built from the default
+	for i := 0; i < 3; i++ {
+		caller := fmt.Sprintf("caller-%d", i)
+		assert.Equal(t, callFrom(ep, caller), nil)
+		assert.Equal(t, errors.Is(callFrom(ep, caller), ErrQuotaExceeded), true)
+	}
+	assert.Equal(t, callFrom(ep, "a"), nil)
+	assert.Equal(t, countStates(q), 4)
+	assert.Equal(t, q.defaults, 3)
+
+	// the removed caller falls back to the default config and keeps its state
+	cli.Change(apollo.QuotaConfigName, `{"*": {"qps": 0.01, "burst": 1}}`)
+	assert.Equal(t, countStates(q), 4)
+	assert.Equal(t, q.defaults, 4)
+	assert.Equal(t, errors.Is(callFrom(ep, "a"), ErrQuotaExceeded), true)
+
+	// the states are dropped with the default config
+	cli.Change(apollo.QuotaConfigName, `{}`)
+	assert.Equal(t, countStates(q), 0)
+	assert.Equal(t, q.defaults, 0)
+}
+
+func TestQuotaDefaultEviction(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.QuotaConfigName, `{"*": {"qps": 0.01, "burst": 1}, "a": {"qps": 0.01, "burst": 1}}`)
+	q := newTestQuotas(t, cli)
+	ep := q.middleware(noopEndpoint)
+
+	assert.Equal(t, callFrom(ep, "a"), nil)
+	for i := 0; i < MaxDefaultQuotaCallers; i++ {
+		assert.Equal(t, callFrom(ep, fmt.Sprintf("caller-%d", i)), nil)
+	}
+	assert.Equal(t, countStates(q), MaxDefaultQuotaCallers+1)
+
+	// the least recently used caller is evicted for the new one, which resets its quota
+	assert.Equal(t, callFrom(ep, "new"), nil)
+	assert.Equal(t, countStates(q), MaxDefaultQuotaCallers+1)
+	assert.Equal(t, q.defaults, MaxDefaultQuotaCallers)
+	_, ok := q.callers.Load("caller-0")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, callFrom(ep, "caller-0"), nil)
+
+	// the callers with explicit config are never evicted
+	_, ok = q.callers.Load("a")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, errors.Is(callFrom(ep, "a"), ErrQuotaExceeded), true)
+}
@@ -15,16 +15,32 @@
 package server
 
 import (
+	"github.com/cloudwego/kitex/pkg/klog"
 	"github.com/cloudwego/kitex/server"
 	"github.com/kitex-contrib/config-apollo/apollo"
 	"github.com/kitex-contrib/config-apollo/utils"
 )
 
-// ApolloServerSuite apollo server config suite, configure limiter config dynamically from apollo.
+// ApolloServerSuite apollo server config suite, configure acl, limiter, quota and payload limit config dynamically from apollo.
 type ApolloServerSuite struct {
 	apolloClient apollo.Client
 	service      string
 	opts         utils.Options
+	// options built by NewSuiteE
+	built []server.Option
+}
+
+type categoryOption struct {
+	category string
+	with     func(service string, cli apollo.Client, opts utils.Options) (server.Option, error)
+}
+
+// suiteCategories the governance categories installed by the suite unless disabled.
+var suiteCategories = []categoryOption{
+	{apollo.ACLConfigName, WithACLE},
+	{apollo.LimiterConfigName, WithLimiterE},
+	{apollo.QuotaConfigName, WithQuotaE},
+	{apollo.PayloadLimitConfigName, WithPayloadLimitE},
 }
 
 // NewSuite service is the destination service.
@@ -40,9 +56,48 @@ func NewSuite(service string, cli apollo.Client, options ...utils.Option,
 	return server_suite
 }
 
-// Options return a list client.Option
+// NewSuiteE creates the suite and builds its options, returns the error instead of
+// panicking in Options when the config params can not be rendered or registered.
+func NewSuiteE(service string, cli apollo.Client, options ...utils.Option,
+) (*ApolloServerSuite, error) {
+	s := NewSuite(service, cli, options...)
+	opts, err := s.OptionsE()
+	if err != nil {
+		return nil, err
+	}
+	s.built = opts
+	return s, nil
+}
+
+// Options return a list server.Option, it panics when failed to build the options.
 func (s *ApolloServerSuite) Options() []server.Option {
-	opts := make([]server.Option, 0, 2)
-	opts = append(opts, WithLimiter(s.service, s.apolloClient, s.opts))
+	if s.built != nil {
+		return s.built
+	}
+	opts, err := s.OptionsE()
+	if err != nil {
+		panic(err)
+	}
 	return opts
 }
+
+// OptionsE return a list server.Option or the error when failed to build them.
+// The config listeners of the categories built before the failed one are deregistered when it fails.
+func (s *ApolloServerSuite) OptionsE() ([]server.Option, error) {
+	tracked := utils.NewTrackedClient(s.apolloClient)
+	opts := make([]server.Option, 0, 4)
+	for _, c := range suiteCategories {
+		if !s.opts.Enabled(c.category) {
+			continue
+		}
+		o, err := c.with(s.service, tracked, s.opts)
+		if err != nil {
+			if err := tracked.DeregisterAll(); err != nil {
+				klog.Warnf("[apollo] %s server deregister config failed: %s", s.service, err)
+			}
+			return nil, err
+		}
+		opts = append(opts, o)
+	}
+	return opts, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+func TestSuiteOptionsE(t *testing.T) {
+	cli := apollotest.NewClient()
+	opts, err := NewSuite("svc", cli).OptionsE()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(opts), 4)
+	assert.Equal(t, cli.Subscriptions(), 4)
+}
+
+func TestSuiteOptionsEReleaseOnError(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Failing = apollo.PayloadLimitConfigName
+	opts, err := NewSuite("svc", cli).OptionsE()
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, len(opts), 0)
+	// the categories built before payload_limit are deregistered
+	assert.Equal(t, cli.Subscriptions(), 0)
+	// the apollo client shared with the other suites keeps running
+	assert.Equal(t, cli.Closed(), false)
+
+	_, err = NewSuiteE("svc", cli, utils.DisableCategories(apollo.PayloadLimitConfigName))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cli.Subscriptions(), 3)
+}
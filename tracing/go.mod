@@ -0,0 +1,39 @@
+module github.com/kitex-contrib/config-apollo/tracing
+
+go 1.21
+
+require (
+	github.com/cloudwego/kitex v0.7.3
+	github.com/kitex-contrib/config-apollo v0.0.0
+	go.opentelemetry.io/otel/sdk v1.19.0
+	go.opentelemetry.io/otel/trace v1.19.0
+	gopkg.in/go-playground/assert.v1 v1.2.1
+)
+
+require (
+	github.com/apache/thrift v0.16.0 // indirect
+	github.com/apolloconfig/agollo/v4 v4.3.1 // indirect
+	github.com/bytedance/gopkg v0.0.0-20230728082804-614d0af6619b // indirect
+	github.com/bytedance/sonic v1.10.2 // indirect
+	github.com/chenzhuoyu/base64x v0.0.0-20230717121745-296ad89f973d // indirect
+	github.com/chenzhuoyu/iasm v0.9.0 // indirect
+	github.com/choleraehyq/pid v0.0.17 // indirect
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/pprof v0.0.0-20230509042627-b1315fad0c5a // indirect
+	github.com/klauspost/cpuid/v2 v2.2.4 // indirect
+	github.com/shima-park/agollo v1.2.14 // indirect
+	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
+	go.opentelemetry.io/otel v1.19.0 // indirect
+	go.opentelemetry.io/otel/metric v1.19.0 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/arch v0.2.0 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230526203410-71b5a4ffd15e // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/kitex-contrib/config-apollo => ../
+
+replace github.com/apache/thrift => github.com/apache/thrift v0.13.0
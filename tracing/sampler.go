@@ -0,0 +1,157 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/cloudwego/kitex/pkg/klog"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// DefaultSampleRatio the ratio used before the config is loaded or when the ratio is not set.
+const DefaultSampleRatio = 1.0
+
+// Config the tracing sampling config.
+type Config struct {
+	// Ratio the global sample ratio in [0, 1], DefaultSampleRatio if it's not set.
+	Ratio *float64 `json:"ratio"`
+	// Methods the sample ratio of the methods, overriding the global ratio.
+	Methods map[string]float64 `json:"methods"`
+	// ForceCallers the caller service names whose requests are always sampled.
+	ForceCallers []string `json:"force_callers"`
+}
+
+// Validate checks the config.
+func (c *Config) Validate() error {
+	if c.Ratio != nil && (*c.Ratio < 0 || *c.Ratio > 1) {
+		return fmt.Errorf("ratio %v is out of [0, 1]", *c.Ratio)
+	}
+	for method, ratio := range c.Methods {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("ratio %v of method %s is out of [0, 1]", ratio, method)
+		}
+	}
+	return nil
+}
+
+// samplingPolicy the compiled Config.
+type samplingPolicy struct {
+	global  sdktrace.Sampler
+	methods map[string]sdktrace.Sampler
+	callers utils.Set
+}
+
+func newSamplingPolicy(c *Config) *samplingPolicy {
+	ratio := DefaultSampleRatio
+	if c.Ratio != nil {
+		ratio = *c.Ratio
+	}
+	p := &samplingPolicy{
+		global:  sdktrace.TraceIDRatioBased(ratio),
+		methods: make(map[string]sdktrace.Sampler, len(c.Methods)),
+		callers: utils.Set{},
+	}
+	for method, r := range c.Methods {
+		p.methods[method] = sdktrace.TraceIDRatioBased(r)
+	}
+	for _, caller := range c.ForceCallers {
+		p.callers[caller] = true
+	}
+	return p
+}
+
+// Sampler an OpenTelemetry sampler whose ratio is updated by the config from apollo configuration center.
+// The method and the caller are taken from the rpcinfo of the context, the method falls back to the span
+// name if there is no rpcinfo. Wrap it with sdktrace.ParentBased to follow the decision of the parent span.
+type Sampler struct {
+	apolloClient apollo.Client
+	param        apollo.ConfigParam
+	uniqueID     int64
+	policy       atomic.Value // *samplingPolicy
+}
+
+var _ sdktrace.Sampler = &Sampler{}
+
+// NewSampler subscribes the tracing config of the service.
+func NewSampler(service string, apolloClient apollo.Client, opts utils.Options) (*Sampler, error) {
+	param, err := apolloClient.ServerConfigParam(&apollo.ConfigParamConfig{
+		Category:          apollo.TracingConfigName,
+		ServerServiceName: service,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range opts.ApolloCustomFunctions {
+		f(&param)
+	}
+	s := &Sampler{
+		apolloClient: apolloClient,
+		param:        param,
+		uniqueID:     apollo.GetUniqueID(),
+	}
+	s.policy.Store(newSamplingPolicy(&Config{}))
+
+	onChangeCallback := func(data string, parser apollo.ConfigParser) error {
+		cfg := &Config{}
+		err := parser.Decode(param.Type, data, cfg)
+		if err != nil {
+			klog.Warnf("[apollo] %s apollo tracing: unmarshal data %s failed: %s, skip...", service, data, err)
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			klog.Warnf("[apollo] %s tracing config is invalid: %s, skip...", service, err)
+			return err
+		}
+		s.policy.Store(newSamplingPolicy(cfg))
+		return nil
+	}
+
+	if err := apolloClient.RegisterConfigCallback(param, onChangeCallback, s.uniqueID); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ShouldSample implements sdktrace.Sampler.
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	policy := s.policy.Load().(*samplingPolicy)
+	method := p.Name
+	if ri := rpcinfo.GetRPCInfo(p.ParentContext); ri != nil {
+		method = ri.To().Method()
+		if from := ri.From(); from != nil && policy.callers[from.ServiceName()] {
+			return sdktrace.AlwaysSample().ShouldSample(p)
+		}
+	}
+	if sampler, ok := policy.methods[method]; ok {
+		return sampler.ShouldSample(p)
+	}
+	return policy.global.ShouldSample(p)
+}
+
+// Description implements sdktrace.Sampler.
+func (s *Sampler) Description() string {
+	return "ApolloSampler{" + s.param.Key + "}"
+}
+
+// Close cancels the config listener.
+func (s *Sampler) Close() error {
+	return s.apolloClient.DeregisterConfig(s.param, s.uniqueID)
+}
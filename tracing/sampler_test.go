@@ -0,0 +1,83 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/go-playground/assert.v1"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+	"github.com/kitex-contrib/config-apollo/internal/apollotest"
+	"github.com/kitex-contrib/config-apollo/utils"
+)
+
+// sampled reports whether the span of the call is sampled, the span name is the method without rpcinfo.
+func sampled(s *Sampler, caller, method string) bool {
+	ctx := context.Background()
+	if caller != "" {
+		ri := rpcinfo.NewRPCInfo(rpcinfo.NewEndpointInfo(caller, "", nil, nil),
+			rpcinfo.NewEndpointInfo("svc", method, nil, nil), rpcinfo.NewInvocation("svc", method), nil, nil)
+		ctx = rpcinfo.NewCtxWithRPCInfo(ctx, ri)
+	}
+	res := s.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: ctx,
+		TraceID:       trace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		Name:          method,
+	})
+	return res.Decision == sdktrace.RecordAndSample
+}
+
+func TestSamplerPrecedence(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.TracingConfigName, `{"ratio": 0, "methods": {"echo": 1, "quiet": 0}, "force_callers": ["vip"]}`)
+	s, err := NewSampler("svc", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+
+	// the method ratio overrides the global ratio
+	assert.Equal(t, sampled(s, "cli", "echo"), true)
+	assert.Equal(t, sampled(s, "cli", "other"), false)
+	// the force callers override the method ratio
+	assert.Equal(t, sampled(s, "vip", "quiet"), true)
+	assert.Equal(t, sampled(s, "cli", "quiet"), false)
+	// the method falls back to the span name without rpcinfo
+	assert.Equal(t, sampled(s, "", "echo"), true)
+	assert.Equal(t, sampled(s, "", "other"), false)
+}
+
+func TestSamplerUpdate(t *testing.T) {
+	cli := apollotest.NewClient()
+	cli.Change(apollo.TracingConfigName, `{}`)
+	s, err := NewSampler("svc", cli, utils.Options{})
+	assert.Equal(t, err, nil)
+	// everything is sampled by default
+	assert.Equal(t, sampled(s, "cli", "echo"), true)
+
+	cli.Change(apollo.TracingConfigName, `{"ratio": 0}`)
+	assert.Equal(t, sampled(s, "cli", "echo"), false)
+
+	// the invalid config is skipped
+	cli.Change(apollo.TracingConfigName, `{"ratio": 2}`)
+	assert.Equal(t, sampled(s, "cli", "echo"), false)
+
+	cli.Change(apollo.TracingConfigName, `{"ratio": 0, "methods": {"echo": 1}}`)
+	assert.Equal(t, sampled(s, "cli", "echo"), true)
+	assert.Equal(t, sampled(s, "cli", "other"), false)
+	assert.Equal(t, s.Close(), nil)
+}
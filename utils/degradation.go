@@ -0,0 +1,107 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/cloudwego/kitex/pkg/kerrors"
+)
+
+// ErrDegraded is returned for the requests rejected by the degradation config without error_code.
+var ErrDegraded = errors.New("request degraded by apollo config")
+
+// DegradationConfig the degradation config of a method, the key is method name and wildcard "*"
+// matches the methods without explicit config.
+type DegradationConfig struct {
+	Enabled bool `json:"enabled"`
+	// Percentage the percentage of the rejected requests in [0, 100], 100 if not set.
+	Percentage *float64 `json:"percentage"`
+	// ErrorCode the code of the biz status error returned, ErrDegraded is returned if it's 0.
+	ErrorCode int32 `json:"error_code"`
+	// Message the message of the error returned.
+	Message string `json:"message"`
+}
+
+// Validate checks the config.
+func (c *DegradationConfig) Validate() error {
+	if c.Percentage != nil && (*c.Percentage < 0 || *c.Percentage > 100) {
+		return fmt.Errorf("percentage %v is out of [0, 100]", *c.Percentage)
+	}
+	return nil
+}
+
+type degradationRule struct {
+	percentage float64
+	err        error
+}
+
+// DegradationContainer holds the degradation configs of the methods, the configs are
+// swapped as a whole so the hot path is lock free.
+type DegradationContainer struct {
+	rules atomic.Value // map[string]*degradationRule
+}
+
+// NewDegradationContainer creates an empty DegradationContainer.
+func NewDegradationContainer() *DegradationContainer {
+	c := &DegradationContainer{}
+	c.rules.Store(map[string]*degradationRule{})
+	return c
+}
+
+// NotifyPolicyChange replaces the configs, the invalid and disabled configs are ignored.
+func (c *DegradationContainer) NotifyPolicyChange(configs map[string]*DegradationConfig) {
+	rules := make(map[string]*degradationRule, len(configs))
+	for method, cfg := range configs {
+		if cfg == nil || !cfg.Enabled || cfg.Validate() != nil {
+			continue
+		}
+		r := &degradationRule{percentage: 100}
+		if cfg.Percentage != nil {
+			r.percentage = *cfg.Percentage
+		}
+		switch {
+		case cfg.ErrorCode != 0:
+			r.err = kerrors.NewBizStatusError(cfg.ErrorCode, cfg.Message)
+		case cfg.Message != "":
+			r.err = fmt.Errorf("%w: %s", ErrDegraded, cfg.Message)
+		default:
+			r.err = ErrDegraded
+		}
+		rules[method] = r
+	}
+	c.rules.Store(rules)
+}
+
+// Reject returns the error if the request of the method is rejected, or nil.
+func (c *DegradationContainer) Reject(method string) error {
+	rules := c.rules.Load().(map[string]*degradationRule)
+	if len(rules) == 0 {
+		return nil
+	}
+	r, ok := rules[method]
+	if !ok {
+		if r, ok = rules["*"]; !ok {
+			return nil
+		}
+	}
+	if r.percentage < 100 && rand.Float64()*100 >= r.percentage {
+		return nil
+	}
+	return r.err
+}
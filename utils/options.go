@@ -21,7 +21,75 @@ type Option interface {
 	Apply(*Options)
 }
 
+// OptionFunc is used to custom Options with a function.
+type OptionFunc func(*Options)
+
+// Apply implements Option.
+func (f OptionFunc) Apply(o *Options) {
+	f(o)
+}
+
+// optInCategories the governance categories installed by the suite only when enabled by EnableCategories,
+// as they replace the options set by the user, e.g. the load balancer, or change the outbound calls.
+var optInCategories = Set{
+	apollo.LoadBalanceConfigName: true,
+	apollo.RoutingConfigName:     true,
+	apollo.MetadataConfigName:    true,
+}
+
 // Options is used to initialize the apollo config suit or option.
 type Options struct {
 	ApolloCustomFunctions []apollo.CustomFunction
+	// DisabledCategories the governance categories which are not installed by the suite.
+	DisabledCategories Set
+	// EnabledCategories the opt-in governance categories which are installed by the suite.
+	EnabledCategories Set
+	// LimiterAlgorithms whether the algorithm of the server limiter document could be selected.
+	LimiterAlgorithms bool
+}
+
+// Enabled reports whether the category is installed by the suite.
+func (o *Options) Enabled(category string) bool {
+	if optInCategories[category] {
+		return o.EnabledCategories[category]
+	}
+	return !o.DisabledCategories[category]
+}
+
+// DisableCategories disables the governance categories in the suite, e.g. apollo.RetryConfigName,
+// no apollo watcher is registered for the disabled categories.
+func DisableCategories(categories ...string) Option {
+	return OptionFunc(func(o *Options) {
+		if o.DisabledCategories == nil {
+			o.DisabledCategories = Set{}
+		}
+		for _, category := range categories {
+			o.DisabledCategories[category] = true
+			delete(o.EnabledCategories, category)
+		}
+	})
+}
+
+// EnableCategories enables the governance categories disabled before, or the opt-in ones which are
+// not installed by default: apollo.LoadBalanceConfigName, apollo.RoutingConfigName and apollo.MetadataConfigName.
+func EnableCategories(categories ...string) Option {
+	return OptionFunc(func(o *Options) {
+		if o.EnabledCategories == nil {
+			o.EnabledCategories = Set{}
+		}
+		for _, category := range categories {
+			delete(o.DisabledCategories, category)
+			o.EnabledCategories[category] = true
+		}
+	})
+}
+
+// EnableLimiterAlgorithms enables the algorithm selection of the server limiter document. The QPS limiter
+// switching between the algorithms at runtime is installed to the server whatever the algorithm is, which
+// is checked by kitex after the request is decoded instead of before, so the requests over the limit
+// cost the decoding.
+func EnableLimiterAlgorithms() Option {
+	return OptionFunc(func(o *Options) {
+		o.LimiterAlgorithms = true
+	})
 }
@@ -0,0 +1,149 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	kutils "github.com/cloudwego/kitex/pkg/utils"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrPayloadTooLarge is the cause of the errors returned for the payloads over the limits.
+	ErrPayloadTooLarge = errors.New("payload too large")
+	// ErrPayloadSizeUnknown is the cause of the errors returned when the size of a payload with a limit
+	// is unknown, so the limit is not skipped silently.
+	ErrPayloadSizeUnknown = errors.New("payload size unknown")
+)
+
+// UnknownPayloadSize the size of the payloads whose size is unknown.
+const UnknownPayloadSize int64 = -1
+
+// PayloadLimitConfig the payload limits of a method in bytes, the key is method name and wildcard "*"
+// matches the methods without explicit config. No limit if it's 0.
+type PayloadLimitConfig struct {
+	MaxRequestBytes  int64 `json:"max_request_bytes"`
+	MaxResponseBytes int64 `json:"max_response_bytes"`
+}
+
+// Validate checks the config.
+func (c *PayloadLimitConfig) Validate() error {
+	if c.MaxRequestBytes < 0 || c.MaxResponseBytes < 0 {
+		return fmt.Errorf("max_request_bytes and max_response_bytes must not be negative")
+	}
+	return nil
+}
+
+// PayloadLimitContainer holds the payload limits of the methods, the configs are
+// swapped as a whole so the hot path is lock free.
+type PayloadLimitContainer struct {
+	limits atomic.Value // map[string]*PayloadLimitConfig
+}
+
+// NewPayloadLimitContainer creates an empty PayloadLimitContainer.
+func NewPayloadLimitContainer() *PayloadLimitContainer {
+	c := &PayloadLimitContainer{}
+	c.limits.Store(map[string]*PayloadLimitConfig{})
+	return c
+}
+
+// NotifyPolicyChange replaces the configs, the invalid configs are ignored.
+func (c *PayloadLimitContainer) NotifyPolicyChange(configs map[string]*PayloadLimitConfig) {
+	limits := make(map[string]*PayloadLimitConfig, len(configs))
+	for method, cfg := range configs {
+		if cfg == nil || cfg.Validate() != nil {
+			continue
+		}
+		limits[method] = cfg
+	}
+	c.limits.Store(limits)
+}
+
+// Get returns the limits of the method, or nil if there is no limit.
+func (c *PayloadLimitContainer) Get(method string) *PayloadLimitConfig {
+	limits := c.limits.Load().(map[string]*PayloadLimitConfig)
+	if len(limits) == 0 {
+		return nil
+	}
+	if l, ok := limits[method]; ok {
+		return l
+	}
+	return limits["*"]
+}
+
+// CheckRequest returns the error if the request size is over the limit or UnknownPayloadSize, or nil.
+func (c *PayloadLimitConfig) CheckRequest(method string, size int64) error {
+	return checkPayload("request", method, size, c.MaxRequestBytes)
+}
+
+// CheckResponse returns the error if the response size is over the limit or UnknownPayloadSize, or nil.
+func (c *PayloadLimitConfig) CheckResponse(method string, size int64) error {
+	return checkPayload("response", method, size, c.MaxResponseBytes)
+}
+
+func checkPayload(kind, method string, size, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	if size < 0 {
+		return fmt.Errorf("%w: %s of method %s could not be checked against the limit of %d bytes",
+			ErrPayloadSizeUnknown, kind, method, limit)
+	}
+	if size <= limit {
+		return nil
+	}
+	return fmt.Errorf("%w: %s of method %s is %d bytes, over the limit of %d bytes",
+		ErrPayloadTooLarge, kind, method, size, limit)
+}
+
+// EstimatePayloadSize estimates the encoded size of the message by the generated code, which is
+// BLength of the thrift fast codec, Size of the kitex protobuf fast api, or proto.Size of the protobuf
+// message. The args and the result structs of kitex are unwrapped if they provide none of them.
+// It returns false if it's unknown.
+func EstimatePayloadSize(msg interface{}) (int64, bool) {
+	if size, ok := estimateSize(msg); ok {
+		return size, true
+	}
+	switch m := msg.(type) {
+	case kutils.KitexArgs:
+		return estimateSize(m.GetFirstArgument())
+	case kutils.KitexResult:
+		return estimateSize(m.GetResult())
+	}
+	return 0, false
+}
+
+func estimateSize(msg interface{}) (int64, bool) {
+	switch m := msg.(type) {
+	case interface{ BLength() int }:
+		return int64(m.BLength()), true
+	case interface{ Size() int }:
+		return int64(m.Size()), true
+	case proto.Message:
+		return int64(proto.Size(m)), true
+	}
+	return 0, false
+}
+
+// PayloadSize returns the estimated size of the message, or UnknownPayloadSize.
+func PayloadSize(msg interface{}) int64 {
+	if size, ok := EstimatePayloadSize(msg); ok {
+		return size
+	}
+	return UnknownPayloadSize
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/kitex-examples/kitex_gen/api"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// protoArgs mimics the args and the result generated by kitex for protobuf without the fast api,
+// which provide neither BLength nor Size.
+type protoArgs struct {
+	Req  *wrapperspb.StringValue
+	Resp *wrapperspb.StringValue
+}
+
+func (p *protoArgs) GetFirstArgument() interface{} { return p.Req }
+
+type protoResult struct {
+	Success *wrapperspb.StringValue
+}
+
+func (p *protoResult) GetResult() interface{}   { return p.Success }
+func (p *protoResult) SetSuccess(x interface{}) { p.Success = x.(*wrapperspb.StringValue) }
+
+func TestEstimatePayloadSize(t *testing.T) {
+	req := &api.Request{Message: "hello"}
+	size, ok := EstimatePayloadSize(req)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, size, int64(req.BLength()))
+
+	args := &api.EchoEchoArgs{Req: req}
+	size, ok = EstimatePayloadSize(args)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, size, int64(args.BLength()))
+
+	msg := wrapperspb.String("hello")
+	size, ok = EstimatePayloadSize(msg)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, size, int64(proto.Size(msg)))
+
+	// the args and the result without the fast api are unwrapped
+	size, ok = EstimatePayloadSize(&protoArgs{Req: msg})
+	assert.Equal(t, ok, true)
+	assert.Equal(t, size, int64(proto.Size(msg)))
+	size, ok = EstimatePayloadSize(&protoResult{Success: msg})
+	assert.Equal(t, ok, true)
+	assert.Equal(t, size, int64(proto.Size(msg)))
+
+	_, ok = EstimatePayloadSize("hello")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, PayloadSize(struct{}{}), UnknownPayloadSize)
+}
+
+func TestCheckPayload(t *testing.T) {
+	c := &PayloadLimitConfig{MaxRequestBytes: 10}
+	assert.Equal(t, c.CheckRequest("Echo", 10), nil)
+	assert.Equal(t, errors.Is(c.CheckRequest("Echo", 11), ErrPayloadTooLarge), true)
+	assert.Equal(t, errors.Is(c.CheckRequest("Echo", UnknownPayloadSize), ErrPayloadSizeUnknown), true)
+
+	// the unknown size is fine without the limit
+	assert.Equal(t, c.CheckResponse("Echo", UnknownPayloadSize), nil)
+}
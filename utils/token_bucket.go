@@ -0,0 +1,105 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket a token bucket rate limiter, which could be reconfigured without losing its tokens.
+type TokenBucket struct {
+	mu     sync.Mutex
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full TokenBucket, burst is ceil(qps) when it's not positive.
+func NewTokenBucket(qps float64, burst int) *TokenBucket {
+	b := &TokenBucket{last: time.Now()}
+	b.SetLimit(qps, burst)
+	b.tokens = b.burst
+	return b
+}
+
+// SetLimit updates the qps and burst, the tokens over the new burst are dropped.
+func (b *TokenBucket) SetLimit(qps float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	b.qps = qps
+	b.burst = float64(burst)
+	if b.burst <= 0 {
+		b.burst = math.Max(1, math.Ceil(qps))
+	}
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Allow takes a token if there is one.
+func (b *TokenBucket) Allow() bool {
+	_, ok := b.Reserve(0)
+	return ok
+}
+
+// Reserve takes a token and returns the duration to wait before it's available, no token is taken
+// and false is returned if the duration is longer than maxWait.
+func (b *TokenBucket) Reserve(maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.advance(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if b.qps <= 0 {
+		return 0, false
+	}
+	wait := time.Duration((1 - b.tokens) / b.qps * float64(time.Second))
+	if wait > maxWait {
+		return 0, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// advance adds the tokens generated since the last call.
+func (b *TokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.qps)
+		b.last = now
+	}
+}
+
+// Tokens returns the available tokens.
+func (b *TokenBucket) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	return b.tokens
+}
+
+// SetTokens sets the available tokens, capped by the burst.
+func (b *TokenBucket) SetTokens(tokens float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	b.tokens = math.Min(b.burst, tokens)
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestTokenBucketBurst(t *testing.T) {
+	b := NewTokenBucket(1, 3)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, b.Allow(), true)
+	}
+	assert.Equal(t, b.Allow(), false)
+
+	// burst defaults to ceil(qps)
+	b = NewTokenBucket(2.5, 0)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, b.Allow(), true)
+	}
+	assert.Equal(t, b.Allow(), false)
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	b := NewTokenBucket(100, 1)
+	assert.Equal(t, b.Allow(), true)
+	assert.Equal(t, b.Allow(), false)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, b.Allow(), true)
+
+	// the tokens never exceed the burst
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, b.Tokens() <= 1, true)
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := NewTokenBucket(10, 1)
+	wait, ok := b.Reserve(0)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, wait, time.Duration(0))
+
+	// the next token is available in about 100ms
+	_, ok = b.Reserve(10 * time.Millisecond)
+	assert.Equal(t, ok, false)
+	wait, ok = b.Reserve(time.Second)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, wait > 50*time.Millisecond && wait <= 100*time.Millisecond, true)
+
+	// no token is generated without qps
+	b = NewTokenBucket(0, 1)
+	assert.Equal(t, b.Allow(), true)
+	_, ok = b.Reserve(time.Hour)
+	assert.Equal(t, ok, false)
+}
+
+func TestTokenBucketSetLimit(t *testing.T) {
+	b := NewTokenBucket(1, 10)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, b.Allow(), true)
+	}
+
+	// the tokens left are kept on update
+	b.SetLimit(1, 20)
+	tokens := b.Tokens()
+	assert.Equal(t, tokens >= 5 && tokens < 6, true)
+
+	// and capped by the new burst
+	b.SetLimit(1, 2)
+	assert.Equal(t, b.Tokens(), float64(2))
+}
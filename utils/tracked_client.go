@@ -0,0 +1,69 @@
+// Copyright 2023 CloudWeGo Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/kitex-contrib/config-apollo/apollo"
+)
+
+type registration struct {
+	param    apollo.ConfigParam
+	uniqueID int64
+}
+
+// TrackedClient wraps the apollo client to record the config callbacks registered through it,
+// the suites use it to deregister the callbacks of the built categories when a later one fails.
+type TrackedClient struct {
+	apollo.Client
+
+	mu         sync.Mutex
+	registered []registration
+}
+
+// NewTrackedClient wraps the apollo client.
+func NewTrackedClient(cli apollo.Client) *TrackedClient {
+	return &TrackedClient{Client: cli}
+}
+
+// RegisterConfigCallback implements apollo.Client.
+func (c *TrackedClient) RegisterConfigCallback(param apollo.ConfigParam,
+	callback func(string, apollo.ConfigParser) error, uniqueID int64,
+) error {
+	if err := c.Client.RegisterConfigCallback(param, callback, uniqueID); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.registered = append(c.registered, registration{param: param, uniqueID: uniqueID})
+	c.mu.Unlock()
+	return nil
+}
+
+// DeregisterAll deregisters all the config callbacks registered through the client.
+func (c *TrackedClient) DeregisterAll() error {
+	c.mu.Lock()
+	registered := c.registered
+	c.registered = nil
+	c.mu.Unlock()
+	var errs []error
+	for _, r := range registered {
+		if err := c.Client.DeregisterConfig(r.param, r.uniqueID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}